@@ -0,0 +1,156 @@
+package quant
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Bucket represents a bucket of a value distribution. It counts the
+// values which are less than or equal to the upper bound and greater
+// than the upper bound of the previous bucket.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// LinearBuckets returns count bucket upper bounds, where the lowest bound
+// is start and each following bound is width greater than the previous
+// one. The function panics if count is less than one or width is not
+// positive.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 {
+		panic(fmt.Errorf("invalid number of buckets: %d", count))
+	}
+	if !(width > 0) {
+		panic(fmt.Errorf("invalid bucket width: %g", width))
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start + float64(i)*width
+	}
+	return buckets
+}
+
+// ExponentialBuckets returns count bucket upper bounds, where the lowest
+// bound is start and each following bound is the previous one multiplied
+// by factor. The function panics if count is less than one, start is not
+// positive or factor is not greater than one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 {
+		panic(fmt.Errorf("invalid number of buckets: %d", count))
+	}
+	if !(start > 0) {
+		panic(fmt.Errorf("invalid start of buckets: %g", start))
+	}
+	if !(factor > 1) {
+		panic(fmt.Errorf("invalid bucket factor: %g", factor))
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start * math.Pow(factor, float64(i))
+	}
+	return buckets
+}
+
+// checkBuckets validates the given bucket upper bounds and returns a
+// copy of them. A trailing +Inf bound is dropped, because the bucket for
+// all values greater than the highest bound is always added. The
+// function panics if the bounds are empty, not finite or not strictly
+// increasing.
+func checkBuckets(buckets []float64) []float64 {
+	if n := len(buckets); n != 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+	if len(buckets) == 0 {
+		panic(fmt.Errorf("no buckets specified"))
+	}
+	if !validBuckets(buckets) {
+		panic(fmt.Errorf("invalid bucket upper bounds: %v", buckets))
+	}
+	return append([]float64(nil), buckets...)
+}
+
+// validBuckets reports whether the bucket upper bounds are finite and
+// strictly increasing.
+func validBuckets(bounds []float64) bool {
+	for i, b := range bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) || (i > 0 && b <= bounds[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// bucketCounts counts values in buckets with explicit upper bounds. It
+// has one count more than bounds, for the values which are greater than
+// the highest bound.
+type bucketCounts struct {
+	bounds []float64
+	counts []uint64
+}
+
+func newBucketCounts(bounds []float64) *bucketCounts {
+	return &bucketCounts{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (b *bucketCounts) clone() *bucketCounts {
+	if b == nil {
+		return nil
+	}
+	return &bucketCounts{
+		bounds: b.bounds,
+		counts: append([]uint64(nil), b.counts...),
+	}
+}
+
+func (b *bucketCounts) add(value float64, n uint64) {
+	b.counts[sort.SearchFloat64s(b.bounds, value)] += n
+}
+
+// sameBounds reports whether both bucket counts have the same bounds,
+// which is required for merging them.
+func (b *bucketCounts) sameBounds(other *bucketCounts) bool {
+	if b == nil || other == nil || len(b.bounds) != len(other.bounds) {
+		return false
+	}
+	for i, bound := range b.bounds {
+		if bound != other.bounds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bucketCounts) merge(other *bucketCounts) {
+	for i, n := range other.counts {
+		b.counts[i] += n
+	}
+}
+
+// scaled returns a copy of the bucket counts whose bounds are multiplied
+// by the given factor.
+func (b *bucketCounts) scaled(factor float64) *bucketCounts {
+	res := b.clone()
+	res.bounds = make([]float64, len(b.bounds))
+	for i, bound := range b.bounds {
+		res.bounds[i] = bound * factor
+	}
+	return res
+}
+
+// buckets returns all buckets including the empty ones. The upper bound
+// of the last bucket is +Inf.
+func (b *bucketCounts) buckets() []Bucket {
+	res := make([]Bucket, len(b.counts))
+	for i, n := range b.counts {
+		res[i] = Bucket{UpperBound: math.Inf(1), Count: n}
+		if i < len(b.bounds) {
+			res[i].UpperBound = b.bounds[i]
+		}
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+package quant
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLinearBuckets(t *testing.T) {
+	buckets := LinearBuckets(1, 2, 4)
+	if expected := []float64{1, 3, 5, 7}; !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong buckets: %v (%v expected)", buckets, expected)
+	}
+	expectPanic(t, func() { LinearBuckets(1, 0, 4) })
+	expectPanic(t, func() { LinearBuckets(1, 2, 0) })
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	buckets := ExponentialBuckets(0.5, 2, 4)
+	if expected := []float64{0.5, 1, 2, 4}; !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong buckets: %v (%v expected)", buckets, expected)
+	}
+	expectPanic(t, func() { ExponentialBuckets(0, 2, 4) })
+	expectPanic(t, func() { ExponentialBuckets(1, 1, 4) })
+	expectPanic(t, func() { ExponentialBuckets(1, 2, 0) })
+}
+
+func TestBucketedTimer(t *testing.T) {
+	reg := NewRegistry("reg")
+	timer := reg.NewBucketedTimer("latency", Milliseconds, []float64{1, 5, 10, math.Inf(1)})
+	for _, ms := range []int{1, 2, 5, 7, 20} {
+		timer.Update(time.Duration(ms) * time.Millisecond)
+	}
+
+	snap := timer.snapshot()
+	if snap.Count() != 5 || snap.Maximum() != 20 {
+		t.Errorf("wrong statistics: count=%d, max=%v", snap.Count(), snap.Maximum())
+	}
+	expected := []Bucket{{1, 1}, {5, 2}, {10, 1}, {math.Inf(1), 1}}
+	if buckets := snap.Buckets(); !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong buckets: %v (%v expected)", buckets, expected)
+	}
+	expected = []Bucket{{1, 1}, {5, 3}, {10, 4}, {math.Inf(1), 5}}
+	if buckets := snap.CumulativeBuckets(); !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong cumulative buckets: %v (%v expected)", buckets, expected)
+	}
+
+	if next := timer.snapshot(); next.Count() != 0 || len(next.Buckets()) != 4 {
+		t.Errorf("wrong empty snapshot: count=%d, buckets=%v", next.Count(), next.Buckets())
+	}
+
+	expectPanic(t, func() { reg.NewBucketedTimer("other", Milliseconds, nil) })
+	expectPanic(t, func() { reg.NewBucketedTimer("other", Milliseconds, []float64{2, 1}) })
+	expectPanic(t, func() { reg.NewBucketedTimer("latency", Milliseconds, []float64{1}) })
+}
+
+func TestBucketedSnapshotMerge(t *testing.T) {
+	newSnapshot := func(bounds []float64, values ...float64) *HistogramSnapshot {
+		h := newBucketedHistogram("size", "B", bounds)
+		for _, v := range values {
+			h.Observe(v)
+		}
+		return h.snapshot()
+	}
+
+	merged := newHistogramSnapshot("size", "B")
+	merged.Merge(newSnapshot([]float64{10, 100}, 5, 50))
+	merged.Merge(newSnapshot([]float64{10, 100}, 500))
+	expected := []Bucket{{10, 1}, {100, 2}, {math.Inf(1), 3}}
+	if buckets := merged.CumulativeBuckets(); !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong merged buckets: %v (%v expected)", buckets, expected)
+	}
+
+	converted := merged.scaled("kB", 0.001)
+	expected = []Bucket{{0.01, 1}, {0.1, 2}, {math.Inf(1), 3}}
+	if buckets := converted.CumulativeBuckets(); !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("wrong converted buckets: %v (%v expected)", buckets, expected)
+	}
+
+	if err := merged.Merge(newSnapshot([]float64{10, 1000}, 5)); err == nil {
+		t.Error("no error for merging buckets with different bounds")
+	}
+	if merged.Count() != 3 || merged.Buckets() == nil {
+		t.Errorf("snapshot changed by failed merge: count=%d, buckets=%v", merged.Count(), merged.Buckets())
+	}
+	if err := merged.Merge(newHistogramSnapshot("size", "B")); err != nil {
+		t.Errorf("unexpected error for merging an empty snapshot: %v", err)
+	}
+}
+
+func TestBucketedSnapshotEncoding(t *testing.T) {
+	h := newBucketedHistogram("size", "B", LinearBuckets(10, 10, 3))
+	for _, v := range []float64{5, 15, 25, 35, 45} {
+		h.Observe(v)
+	}
+	snap := h.snapshot()
+
+	data, _ := snap.MarshalBinary()
+	var decoded HistogramSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	expectEqualSnapshots(t, &decoded, snap)
+
+	data, _ = json.Marshal(snap)
+	decoded = HistogramSnapshot{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	expectEqualSnapshots(t, &decoded, snap)
+
+	invalid := []byte(`{"name":"size","count":1,"min":1,"max":1,"sum":1,"mean":1,"m2":0,"buckets":{"bounds":[2,1],"counts":[1,0,0]}}`)
+	if err := json.Unmarshal(invalid, &decoded); err == nil {
+		t.Error("decreasing bucket bounds accepted")
+	}
+}
+
+func expectPanic(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for invalid buckets")
+		}
+	}()
+	fn()
+}
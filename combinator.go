@@ -0,0 +1,339 @@
+package quant
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// MatchGlob returns a predicate which reports whether a metric name
+// matches the given shell pattern (see path.Match). Invalid patterns do
+// not match any name.
+func MatchGlob(pattern string) func(name string) bool {
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}
+}
+
+// MatchRegexp returns a predicate which reports whether a metric name
+// matches the given regular expression.
+func MatchRegexp(re *regexp.Regexp) func(name string) bool {
+	return re.MatchString
+}
+
+// FilterReporter returns a reporter which passes only the metrics whose
+// names satisfy the given predicate to the inner reporter. Histograms are
+// passed if the inner reporter implements HistogramReporter.
+func FilterReporter(inner Reporter, match func(name string) bool) Reporter {
+	return &filterReporter{
+		inner: inner,
+		match: match,
+	}
+}
+
+type filterReporter struct {
+	inner Reporter
+	match func(name string) bool
+}
+
+func (r *filterReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	if counters = filterSnapshots(counters, r.match); len(counters) == 0 {
+		return nil
+	}
+	return r.inner.ReportCounters(registryName, counters)
+}
+
+func (r *filterReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	if gauges = filterSnapshots(gauges, r.match); len(gauges) == 0 {
+		return nil
+	}
+	return r.inner.ReportGauges(registryName, gauges)
+}
+
+func (r *filterReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	if timers = filterSnapshots(timers, r.match); len(timers) == 0 {
+		return nil
+	}
+	return r.inner.ReportTimers(registryName, timers)
+}
+
+func (r *filterReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	hr, ok := r.inner.(HistogramReporter)
+	if !ok {
+		return nil
+	}
+	if histograms = filterSnapshots(histograms, r.match); len(histograms) == 0 {
+		return nil
+	}
+	return hr.ReportHistograms(registryName, histograms)
+}
+
+func filterSnapshots[S interface{ Name() string }](snaps []S, match func(string) bool) []S {
+	res := make([]S, 0, len(snaps))
+	for _, s := range snaps {
+		if match(s.Name()) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// RenameReporter returns a reporter which rewrites the metric names with
+// the given function before passing the snapshots to the inner reporter.
+// Histograms are passed if the inner reporter implements HistogramReporter.
+func RenameReporter(inner Reporter, rename func(name string) string) Reporter {
+	return &renameReporter{
+		inner:  inner,
+		rename: rename,
+	}
+}
+
+type renameReporter struct {
+	inner  Reporter
+	rename func(name string) string
+}
+
+func (r *renameReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	return r.inner.ReportCounters(registryName, renameSnapshots(counters, r.rename))
+}
+
+func (r *renameReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	return r.inner.ReportGauges(registryName, renameSnapshots(gauges, r.rename))
+}
+
+func (r *renameReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	return r.inner.ReportTimers(registryName, renameSnapshots(timers, r.rename))
+}
+
+func (r *renameReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	if hr, ok := r.inner.(HistogramReporter); ok {
+		return hr.ReportHistograms(registryName, renameSnapshots(histograms, r.rename))
+	}
+	return nil
+}
+
+type renamable[S any] interface {
+	Name() string
+	withName(name string) S
+}
+
+// renameSnapshots returns copies of the given snapshots with rewritten
+// names. The original snapshots are shared with other reporters and must
+// not be modified.
+func renameSnapshots[S renamable[S]](snaps []S, rename func(string) string) []S {
+	res := make([]S, len(snaps))
+	for i, s := range snaps {
+		res[i] = s.withName(rename(s.Name()))
+	}
+	return res
+}
+
+// MultiReporter returns a reporter which passes all snapshots to each of
+// the given reporters. All reporters are called even if some of them
+// fail, and the errors are joined. Histograms are passed to the reporters
+// which implement HistogramReporter.
+func MultiReporter(reporters ...Reporter) Reporter {
+	return &multiReporter{
+		reporters: reporters,
+	}
+}
+
+type multiReporter struct {
+	reporters []Reporter
+}
+
+func (r *multiReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	var errs []error
+	for _, reporter := range r.reporters {
+		errs = append(errs, reporter.ReportCounters(registryName, counters))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *multiReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	var errs []error
+	for _, reporter := range r.reporters {
+		errs = append(errs, reporter.ReportGauges(registryName, gauges))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *multiReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	var errs []error
+	for _, reporter := range r.reporters {
+		errs = append(errs, reporter.ReportTimers(registryName, timers))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *multiReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	var errs []error
+	for _, reporter := range r.reporters {
+		if hr, ok := reporter.(HistogramReporter); ok {
+			errs = append(errs, hr.ReportHistograms(registryName, histograms))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SampledReporter returns a reporter which passes the snapshots of a
+// registry to the inner reporter only on every n-th report. The calls are
+// counted separately per registry and metric type. Nothing is lost in the
+// skipped reports: the counter deltas are accumulated, and the timer and
+// histogram snapshots are merged into the next passed snapshots. Gauges
+// of skipped reports are dropped. Histograms are passed if the inner
+// reporter implements HistogramReporter.
+func SampledReporter(inner Reporter, n int) Reporter {
+	if n < 1 {
+		n = 1
+	}
+	return &sampledReporter{
+		inner:      inner,
+		n:          n,
+		calls:      make(map[sampledKey]int),
+		counters:   make(map[sampledKey]*CounterSnapshot),
+		timers:     make(map[sampledKey]*TimerSnapshot),
+		histograms: make(map[sampledKey]*HistogramSnapshot),
+	}
+}
+
+type sampledKind int
+
+const (
+	sampledCounters sampledKind = iota
+	sampledGauges
+	sampledTimers
+	sampledHistograms
+)
+
+type sampledKey struct {
+	registry string
+	name     string // empty for call counts
+	kind     sampledKind
+}
+
+type sampledReporter struct {
+	inner Reporter
+	n     int
+
+	mtx        sync.Mutex
+	calls      map[sampledKey]int
+	counters   map[sampledKey]*CounterSnapshot   // accumulated deltas
+	timers     map[sampledKey]*TimerSnapshot     // merged skipped snapshots
+	histograms map[sampledKey]*HistogramSnapshot // merged skipped snapshots
+}
+
+// pass counts a call and reports whether it should be passed to the
+// inner reporter. The caller must hold the lock.
+func (r *sampledReporter) pass(registryName string, kind sampledKind) bool {
+	key := sampledKey{registry: registryName, kind: kind}
+	r.calls[key]++
+	if r.calls[key] < r.n {
+		return false
+	}
+	r.calls[key] = 0
+	return true
+}
+
+func (r *sampledReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	r.mtx.Lock()
+	pass := r.pass(registryName, sampledCounters)
+	res := make([]*CounterSnapshot, 0, len(counters))
+	for _, c := range counters {
+		key := sampledKey{registryName, c.Name(), sampledCounters}
+		if pending := r.counters[key]; pending != nil {
+			c = c.withDelta(pending.Delta()+c.Delta(), pending.FloatDelta()+c.FloatDelta(), pending.PreviousTime())
+		}
+		if pass {
+			delete(r.counters, key)
+			res = append(res, c)
+		} else {
+			r.counters[key] = c
+		}
+	}
+	r.mtx.Unlock()
+
+	if !pass {
+		return nil
+	}
+	return r.inner.ReportCounters(registryName, res)
+}
+
+func (r *sampledReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	r.mtx.Lock()
+	pass := r.pass(registryName, sampledGauges)
+	r.mtx.Unlock()
+
+	if !pass {
+		return nil
+	}
+	return r.inner.ReportGauges(registryName, gauges)
+}
+
+func (r *sampledReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	r.mtx.Lock()
+	pass := r.pass(registryName, sampledTimers)
+	res := make([]*TimerSnapshot, 0, len(timers))
+	for _, t := range timers {
+		key := sampledKey{registryName, t.Name(), sampledTimers}
+		pending := r.timers[key]
+		if pending == nil {
+			if pass {
+				res = append(res, t)
+				continue
+			}
+			pending = newTimerSnaphot(t.name, t.unit)
+			r.timers[key] = pending
+		}
+		pending.merge(&t.reservoirSnapshot)
+		if t.exemplar != nil {
+			pending.exemplar = t.exemplar
+		}
+		if pass {
+			delete(r.timers, key)
+			res = append(res, pending)
+		}
+	}
+	r.mtx.Unlock()
+
+	if !pass {
+		return nil
+	}
+	return r.inner.ReportTimers(registryName, res)
+}
+
+func (r *sampledReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	hr, ok := r.inner.(HistogramReporter)
+	if !ok {
+		return nil
+	}
+
+	r.mtx.Lock()
+	pass := r.pass(registryName, sampledHistograms)
+	res := make([]*HistogramSnapshot, 0, len(histograms))
+	for _, h := range histograms {
+		key := sampledKey{registryName, h.Name(), sampledHistograms}
+		pending := r.histograms[key]
+		if pending == nil {
+			if pass {
+				res = append(res, h)
+				continue
+			}
+			pending = newHistogramSnapshot(h.name, h.unit)
+			r.histograms[key] = pending
+		}
+		pending.merge(&h.reservoirSnapshot)
+		if pass {
+			delete(r.histograms, key)
+			res = append(res, pending)
+		}
+	}
+	r.mtx.Unlock()
+
+	if !pass {
+		return nil
+	}
+	return hr.ReportHistograms(registryName, res)
+}
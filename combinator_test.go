@@ -0,0 +1,151 @@
+package quant
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingReporter records the names of all reported snapshots.
+type recordingReporter struct {
+	names      []string
+	counters   []*CounterSnapshot
+	timers     []*TimerSnapshot
+	histograms []*HistogramSnapshot
+	err        error
+}
+
+func (r *recordingReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	for _, c := range counters {
+		r.names = append(r.names, c.Name())
+	}
+	r.counters = append(r.counters, counters...)
+	return r.err
+}
+
+func (r *recordingReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	for _, g := range gauges {
+		r.names = append(r.names, g.Name())
+	}
+	return r.err
+}
+
+func (r *recordingReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	for _, t := range timers {
+		r.names = append(r.names, t.Name())
+	}
+	r.timers = append(r.timers, timers...)
+	return r.err
+}
+
+func (r *recordingReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	for _, h := range histograms {
+		r.names = append(r.names, h.Name())
+	}
+	r.histograms = append(r.histograms, histograms...)
+	return r.err
+}
+
+func newCombinatorRegistry() *Registry {
+	reg := NewRegistry("reg")
+	reg.NewCounter("http.requests").Add(1)
+	reg.NewGauge("http.inflight", func() float64 { return 1 })
+	reg.NewTimer("db.latency", Milliseconds).Update(time.Millisecond)
+	reg.NewHistogram("http.size").Observe(12)
+	return reg
+}
+
+func TestFilterReporter(t *testing.T) {
+	rec := &recordingReporter{}
+	if err := newCombinatorRegistry().Report(FilterReporter(rec, MatchGlob("http.*"))); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if names := strings.Join(rec.names, ","); names != "http.requests,http.inflight,http.size" {
+		t.Errorf("wrong metrics: %s", names)
+	}
+
+	rec = &recordingReporter{}
+	if err := newCombinatorRegistry().Report(FilterReporter(rec, MatchRegexp(regexp.MustCompile(`latency$`)))); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if names := strings.Join(rec.names, ","); names != "db.latency" {
+		t.Errorf("wrong metrics: %s", names)
+	}
+}
+
+func TestRenameReporter(t *testing.T) {
+	reg := newCombinatorRegistry()
+	rec := &recordingReporter{}
+	r := RenameReporter(rec, func(name string) string { return "app." + name })
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if names := strings.Join(rec.names, ","); names != "app.http.requests,app.http.inflight,app.db.latency,app.http.size" {
+		t.Errorf("wrong metrics: %s", names)
+	}
+	if c := reg.Counter("http.requests"); c.Name() != "http.requests" {
+		t.Errorf("wrong counter name: %s", c.Name())
+	}
+	if rec.timers[0].Count() != 1 {
+		t.Errorf("wrong timer count: %d (1 expected)", rec.timers[0].Count())
+	}
+}
+
+func TestMultiReporter(t *testing.T) {
+	errReport := errors.New("report error")
+	failing := &recordingReporter{err: errReport}
+	rec := &recordingReporter{}
+	err := newCombinatorRegistry().Report(MultiReporter(failing, NullReporter, rec, testTimerOnlyReporter{}))
+	if !errors.Is(err, errReport) {
+		t.Errorf("wrong report error: %v (%v expected)", err, errReport)
+	}
+	if len(failing.names) != 1 || len(rec.names) != 1 {
+		t.Errorf("counters not reported to all reporters: %v, %v", failing.names, rec.names)
+	}
+
+	rec = &recordingReporter{}
+	if err := newCombinatorRegistry().Report(MultiReporter(rec, testTimerOnlyReporter{})); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if len(rec.names) != 4 {
+		t.Errorf("wrong metrics: %v", rec.names)
+	}
+}
+
+func TestSampledReporter(t *testing.T) {
+	reg := NewRegistry("reg")
+	counter := reg.NewCounter("requests")
+	timer := reg.NewTimer("latency", Milliseconds)
+
+	rec := &recordingReporter{}
+	r := SampledReporter(rec, 3)
+	for i := 1; i <= 7; i++ {
+		counter.Add(int64(i))
+		timer.Update(time.Duration(i) * time.Millisecond)
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	if len(rec.counters) != 2 || len(rec.timers) != 2 {
+		t.Fatalf("wrong number of reports: %d, %d (2 expected)", len(rec.counters), len(rec.timers))
+	}
+	if c := rec.counters[1]; c.Value() != 21 || c.Delta() != 15 {
+		t.Errorf("wrong counter: value=%d, delta=%d (21, 15 expected)", c.Value(), c.Delta())
+	}
+	if !rec.counters[0].PreviousTime().IsZero() {
+		t.Errorf("unexpected previous time for the first report: %v", rec.counters[0].PreviousTime())
+	}
+	if tm := rec.timers[1]; tm.Count() != 3 || tm.Minimum() != 4 || tm.Maximum() != 6 {
+		t.Errorf("wrong timer: count=%d, min=%v, max=%v (3, 4, 6 expected)", tm.Count(), tm.Minimum(), tm.Maximum())
+	}
+}
+
+// testTimerOnlyReporter does not implement HistogramReporter.
+type testTimerOnlyReporter struct{}
+
+func (testTimerOnlyReporter) ReportCounters(string, []*CounterSnapshot) error { return nil }
+func (testTimerOnlyReporter) ReportGauges(string, []*GaugeSnapshot) error     { return nil }
+func (testTimerOnlyReporter) ReportTimers(string, []*TimerSnapshot) error     { return nil }
@@ -1,7 +1,10 @@
 package quant
 
 import (
+	"fmt"
+	"math"
 	"sync/atomic"
+	"time"
 )
 
 // Counter represents an int64 metric which can be incremented
@@ -44,20 +47,287 @@ func (c *Counter) Reset() {
 }
 
 func (c *Counter) snapshot() *CounterSnapshot {
-	return &CounterSnapshot{
-		snapshot: snapshot{c.name, c.unit},
-		value:    c.Value(),
+	return newIntCounterSnapshot(c.name, c.unit, c.Value(), false)
+}
+
+// MonotonicCounter represents an int64 metric which can only be
+// increased. In contrast to Counter it cannot be decremented or
+// reset, which makes it suitable for backends with strict counter
+// semantics (e.g. Prometheus). It is safe to use a monotonic counter
+// concurrently.
+type MonotonicCounter struct {
+	metric
+	value int64
+}
+
+func newMonotonicCounter(name string, unit string) *MonotonicCounter {
+	return &MonotonicCounter{
+		metric: metric{name, unit},
+		value:  0,
+	}
+}
+
+// Value returns the current int64 value of the counter.
+func (c *MonotonicCounter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// Increment increases the counter by one.
+func (c *MonotonicCounter) Increment() int64 {
+	return atomic.AddInt64(&c.value, 1)
+}
+
+// Add adds the specified delta to the counter. If the delta is
+// negative this function will panic.
+func (c *MonotonicCounter) Add(delta int64) int64 {
+	if delta < 0 {
+		panic(fmt.Errorf("negative delta for monotonic counter %s: %d", c.name, delta))
+	}
+	return atomic.AddInt64(&c.value, delta)
+}
+
+func (c *MonotonicCounter) snapshot() *CounterSnapshot {
+	return newIntCounterSnapshot(c.name, c.unit, c.Value(), true)
+}
+
+// FloatCounter represents a float64 metric which can be increased
+// and decreased by arbitrary amounts. It can be used to count
+// non-integral quantities like CPU seconds. If the counter is created
+// as a monotonic counter, negative deltas are rejected. It is safe to
+// use a float counter concurrently.
+type FloatCounter struct {
+	metric
+	monotonic bool
+	bits      uint64
+}
+
+func newFloatCounter(name string, unit string, monotonic bool) *FloatCounter {
+	return &FloatCounter{
+		metric:    metric{name, unit},
+		monotonic: monotonic,
+		bits:      math.Float64bits(0),
+	}
+}
+
+// Value returns the current float64 value of the counter.
+func (c *FloatCounter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Monotonic reports whether the counter only accepts non-negative
+// deltas.
+func (c *FloatCounter) Monotonic() bool {
+	return c.monotonic
+}
+
+// Add adds the specified delta to the counter. If the counter is
+// monotonic and the delta is negative this function will panic.
+func (c *FloatCounter) Add(delta float64) float64 {
+	if c.monotonic && delta < 0 {
+		panic(fmt.Errorf("negative delta for monotonic counter %s: %g", c.name, delta))
+	}
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		val := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&c.bits, old, math.Float64bits(val)) {
+			return val
+		}
 	}
 }
 
-// CounterSnapshot represents a snapshot of a Counter metric.
-// This snapshot type is used during the reporting process.
+// Reset sets the counter back to zero. If the counter is monotonic
+// this function will panic.
+func (c *FloatCounter) Reset() {
+	if c.monotonic {
+		panic(fmt.Errorf("reset of monotonic counter %s", c.name))
+	}
+	atomic.StoreUint64(&c.bits, math.Float64bits(0))
+}
+
+func (c *FloatCounter) snapshot() *CounterSnapshot {
+	return newFloatCounterSnapshot(c.name, c.unit, c.Value(), c.monotonic)
+}
+
+// CounterSnapshot represents a snapshot of a Counter, MonotonicCounter
+// or FloatCounter metric. This snapshot type is used during the reporting
+// process.
 type CounterSnapshot struct {
 	snapshot
-	value int64
+	value      int64
+	floatValue float64
+	isFloat    bool
+	monotonic  bool
+	delta      int64
+	floatDelta float64
+	time       time.Time
+	prevTime   time.Time
 }
 
-// Value returns the snapshot value of the underlying counter.
+func newIntCounterSnapshot(name, unit string, value int64, monotonic bool) *CounterSnapshot {
+	return &CounterSnapshot{
+		snapshot:   snapshot{name, unit},
+		value:      value,
+		floatValue: float64(value),
+		isFloat:    false,
+		monotonic:  monotonic,
+		delta:      value,
+		floatDelta: float64(value),
+	}
+}
+
+func newFloatCounterSnapshot(name, unit string, value float64, monotonic bool) *CounterSnapshot {
+	return &CounterSnapshot{
+		snapshot:   snapshot{name, unit},
+		value:      int64(value),
+		floatValue: value,
+		isFloat:    true,
+		monotonic:  monotonic,
+		delta:      int64(value),
+		floatDelta: value,
+	}
+}
+
+// NewCounterSnapshot creates a snapshot of an integer counter with the
+// given value. The delta equals the value and the snapshot time is the
+// current time. It can be used to pass synthetic snapshots to a reporter.
+func NewCounterSnapshot(name, unit string, value int64, monotonic bool) *CounterSnapshot {
+	snap := newIntCounterSnapshot(name, unit, value, monotonic)
+	snap.time = time.Now()
+	return snap
+}
+
+// NewFloatCounterSnapshot creates a snapshot of a float counter with the
+// given value. The delta equals the value and the snapshot time is the
+// current time. It can be used to pass synthetic snapshots to a reporter.
+func NewFloatCounterSnapshot(name, unit string, value float64, monotonic bool) *CounterSnapshot {
+	snap := newFloatCounterSnapshot(name, unit, value, monotonic)
+	snap.time = time.Now()
+	return snap
+}
+
+// WithDelta returns a copy of the snapshot with the given delta and the
+// given point in time of the previous report.
+func (s *CounterSnapshot) WithDelta(delta float64, prevTime time.Time) *CounterSnapshot {
+	return s.withDelta(int64(delta), delta, prevTime)
+}
+
+// Value returns the snapshot value of the underlying counter. For
+// float counters the value is truncated towards zero.
 func (s *CounterSnapshot) Value() int64 {
 	return s.value
 }
+
+// FloatValue returns the snapshot value of the underlying counter
+// as a float64.
+func (s *CounterSnapshot) FloatValue() float64 {
+	return s.floatValue
+}
+
+// IsFloat reports whether the underlying counter is a FloatCounter.
+// In this case FloatValue should be used to retrieve the exact value.
+func (s *CounterSnapshot) IsFloat() bool {
+	return s.isFloat
+}
+
+// Monotonic reports whether the underlying counter can only be
+// increased. Reporters can use this information to distinguish
+// monotonic counters from up/down counters.
+func (s *CounterSnapshot) Monotonic() bool {
+	return s.monotonic
+}
+
+// Delta returns the change of the counter value since the previous
+// report to the same reporter. If the counter was not reported before,
+// the delta equals the value. For float counters the delta is truncated
+// towards zero.
+func (s *CounterSnapshot) Delta() int64 {
+	return s.delta
+}
+
+// FloatDelta returns the change of the counter value since the previous
+// report to the same reporter as a float64.
+func (s *CounterSnapshot) FloatDelta() float64 {
+	return s.floatDelta
+}
+
+// Time returns the point in time the snapshot was taken.
+func (s *CounterSnapshot) Time() time.Time {
+	return s.time
+}
+
+// PreviousTime returns the point in time the counter was previously
+// reported to the same reporter. If the counter was not reported before,
+// the zero time will be returned.
+func (s *CounterSnapshot) PreviousTime() time.Time {
+	return s.prevTime
+}
+
+func (s *CounterSnapshot) withDelta(delta int64, floatDelta float64, prevTime time.Time) *CounterSnapshot {
+	snap := *s
+	if snap.isFloat {
+		snap.delta = int64(floatDelta)
+	} else {
+		snap.delta = delta
+	}
+	snap.floatDelta = floatDelta
+	snap.prevTime = prevTime
+	return &snap
+}
+
+func (s *CounterSnapshot) withName(name string) *CounterSnapshot {
+	snap := *s
+	snap.name = name
+	return &snap
+}
+
+// scaled returns a copy of the snapshot whose values are multiplied by
+// the given factor and which has the given unit.
+func (s *CounterSnapshot) scaled(unit string, factor float64) *CounterSnapshot {
+	snap := *s
+	snap.unit = unit
+	if !snap.isFloat && isIntFactor(factor) {
+		snap.value *= int64(factor)
+		snap.delta *= int64(factor)
+		snap.floatValue = float64(snap.value)
+		snap.floatDelta = float64(snap.delta)
+		return &snap
+	}
+
+	snap.isFloat = true
+	snap.floatValue *= factor
+	snap.floatDelta *= factor
+	snap.value = int64(snap.floatValue)
+	snap.delta = int64(snap.floatDelta)
+	return &snap
+}
+
+// Merge adds the values and deltas of other to the snapshot, e.g. to
+// combine the counters of several processes. The result is a float
+// counter if one of the snapshots is, and monotonic if both are. The
+// snapshot time is the later and the previous time the earlier one of
+// both snapshots. An error is returned if both snapshots have different
+// units.
+func (s *CounterSnapshot) Merge(other *CounterSnapshot) error {
+	if err := checkMergeUnits(&s.snapshot, &other.snapshot); err != nil {
+		return err
+	}
+
+	s.isFloat = s.isFloat || other.isFloat
+	s.monotonic = s.monotonic && other.monotonic
+	s.floatValue += other.floatValue
+	s.floatDelta += other.floatDelta
+	if s.isFloat {
+		s.value = int64(s.floatValue)
+		s.delta = int64(s.floatDelta)
+	} else {
+		s.value += other.value
+		s.delta += other.delta
+	}
+	if other.time.After(s.time) {
+		s.time = other.time
+	}
+	if other.prevTime.Before(s.prevTime) {
+		s.prevTime = other.prevTime
+	}
+	return nil
+}
@@ -52,3 +52,92 @@ func TestConcurrentCounter(t *testing.T) {
 		t.Errorf("wrong counter value: %d (0 expected)", c.Value())
 	}
 }
+
+func TestMonotonicCounter(t *testing.T) {
+	c := newMonotonicCounter("my-counter", "")
+
+	c.Increment()
+	c.Add(4)
+	if c.Value() != 5 {
+		t.Errorf("wrong counter value: %d (5 expected)", c.Value())
+	}
+
+	snap := c.snapshot()
+	if !snap.Monotonic() {
+		t.Error("monotonic counter snapshot is not monotonic")
+	}
+	if snap.IsFloat() {
+		t.Error("monotonic counter snapshot is a float snapshot")
+	}
+}
+
+func TestMonotonicCounterNegativeDelta(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("monotonic counter does not panic for negative deltas")
+		}
+	}()
+
+	c := newMonotonicCounter("my-counter", "")
+	c.Add(-1)
+}
+
+func TestFloatCounter(t *testing.T) {
+	c := newFloatCounter("my-counter", "s", false)
+
+	c.Add(1.5)
+	c.Add(0.25)
+	c.Add(-0.5)
+	if c.Value() != 1.25 {
+		t.Errorf("wrong counter value: %f (1.25 expected)", c.Value())
+	}
+
+	snap := c.snapshot()
+	switch {
+	case !snap.IsFloat():
+		t.Error("float counter snapshot is not a float snapshot")
+	case snap.Monotonic():
+		t.Error("float counter snapshot is monotonic")
+	case snap.FloatValue() != 1.25:
+		t.Errorf("wrong snapshot value: %f (1.25 expected)", snap.FloatValue())
+	case snap.Value() != 1:
+		t.Errorf("wrong truncated snapshot value: %d (1 expected)", snap.Value())
+	}
+
+	c.Reset()
+	if c.Value() != 0 {
+		t.Errorf("wrong counter value: %f (0 expected)", c.Value())
+	}
+}
+
+func TestMonotonicFloatCounterNegativeDelta(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("monotonic float counter does not panic for negative deltas")
+		}
+	}()
+
+	c := newFloatCounter("my-counter", "", true)
+	c.Add(-0.5)
+}
+
+func TestConcurrentFloatCounter(t *testing.T) {
+	const loops = 100000
+	var wg sync.WaitGroup
+	c := newFloatCounter("my-counter", "", false)
+
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			for i := 0; i < loops; i++ {
+				c.Add(0.5)
+			}
+			wg.Done()
+		}()
+	}
+
+	wg.Wait()
+	if c.Value() != loops {
+		t.Errorf("wrong counter value: %f (%d expected)", c.Value(), loops)
+	}
+}
@@ -0,0 +1,372 @@
+package quant
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSVReporter is a Reporter implementation that writes the metric
+// snapshots into CSV files for offline analysis. Each metric is written
+// to its own file "<registry>.<metric>.csv" in the reporter's directory.
+// A header row is written when a file is created, and every report
+// appends a row starting with the report time. Existing files are
+// appended to if their header matches the columns of the metric,
+// otherwise they are rotated first, e.g. after the quantiles changed. The rows of counters and
+// gauges contain the column "value", the rows of timers and histograms
+// contain the columns "count", "min", "max", "mean", "stddev" and one
+// column per quantile (e.g. "p99" for the 0.99-quantile).
+//
+// The files can be rotated based on their size or age. A rotated file is
+// renamed to "<registry>.<metric>.<timestamp>.csv" and optionally
+// compressed with gzip. The age of a file refers to the time of its
+// first row, so it is kept across restarts of the process.
+//
+// The reporter keeps one file open per metric until Close is called.
+//
+// The zero value writes comma-separated files into the current working
+// directory. The exported fields configure the reporter and must not be
+// changed once the reporter is in use.
+type CSVReporter struct {
+	// Quantiles contains the quantiles written for timers and histograms.
+	Quantiles []float64
+	// MaxSize is the size in bytes at which a file is rotated. If it is
+	// zero, the files are not rotated based on their size.
+	MaxSize int64
+	// MaxAge is the duration after which a file is rotated. If it is
+	// zero, the files are not rotated based on their age.
+	MaxAge time.Duration
+	// Compress enables the gzip compression of rotated files.
+	Compress bool
+
+	dir   string
+	comma rune
+	ext   string
+
+	mtx   sync.Mutex
+	files map[string]*csvFile
+}
+
+// NewCSVReporter creates a new reporter which writes comma-separated
+// files into the given directory. The directory is created if it does
+// not exist.
+func NewCSVReporter(dir string) (*CSVReporter, error) {
+	return newCSVReporter(dir, ',', ".csv")
+}
+
+// NewTSVReporter creates a new reporter which writes tab-separated files
+// with the extension ".tsv" into the given directory. The directory is
+// created if it does not exist.
+func NewTSVReporter(dir string) (*CSVReporter, error) {
+	return newCSVReporter(dir, '\t', ".tsv")
+}
+
+func newCSVReporter(dir string, comma rune, ext string) (*CSVReporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &CSVReporter{
+		Quantiles: DefaultQuantiles,
+		dir:       dir,
+		comma:     comma,
+		ext:       ext,
+		files:     make(map[string]*csvFile),
+	}, nil
+}
+
+// Close flushes and closes all open files.
+func (r *CSVReporter) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var errs []error
+	for name, f := range r.files {
+		errs = append(errs, f.close())
+		delete(r.files, name)
+	}
+	return errors.Join(errs...)
+}
+
+// ReportCounters appends a row to the file of each counter.
+func (r *CSVReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var errs []error
+	for _, c := range counters {
+		value := strconv.FormatInt(c.Value(), 10)
+		if c.IsFloat() {
+			value = csvFloat(c.FloatValue())
+		}
+		errs = append(errs, r.write(now, registryName, c.Name(), []string{"value"}, []string{value}))
+	}
+	return errors.Join(errs...)
+}
+
+// ReportGauges appends a row to the file of each gauge. Gauges which
+// could not be read are skipped.
+func (r *CSVReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var errs []error
+	for _, g := range gauges {
+		if g.Err() != nil {
+			continue
+		}
+		value := csvFloat(g.Value())
+		if g.IsInt() {
+			value = strconv.FormatInt(g.IntValue(), 10)
+		}
+		errs = append(errs, r.write(now, registryName, g.Name(), []string{"value"}, []string{value}))
+	}
+	return errors.Join(errs...)
+}
+
+// ReportTimers appends a row to the file of each timer.
+func (r *CSVReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var errs []error
+	for _, t := range timers {
+		errs = append(errs, r.writeReservoir(now, registryName, &t.reservoirSnapshot))
+	}
+	return errors.Join(errs...)
+}
+
+// ReportHistograms appends a row to the file of each histogram.
+func (r *CSVReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var errs []error
+	for _, h := range histograms {
+		errs = append(errs, r.writeReservoir(now, registryName, &h.reservoirSnapshot))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *CSVReporter) writeReservoir(now time.Time, registryName string, s *reservoirSnapshot) error {
+	header := []string{"count", "min", "max", "mean", "stddev"}
+	values := []string{
+		strconv.Itoa(s.Count()),
+		csvFloat(s.Minimum()),
+		csvFloat(s.Maximum()),
+		csvFloat(s.Average()),
+		csvFloat(s.StdDeviation()),
+	}
+	for _, q := range r.Quantiles {
+		header = append(header, quantileName(q))
+		values = append(values, csvFloat(s.Quantile(q)))
+	}
+	return r.write(now, registryName, s.Name(), header, values)
+}
+
+// write appends a row to the file of the given metric and rotates the
+// file if necessary. The caller must hold the lock.
+func (r *CSVReporter) write(now time.Time, registryName, name string, header, values []string) error {
+	if r.files == nil {
+		r.files = make(map[string]*csvFile)
+	}
+	header = append([]string{"time"}, header...)
+	base := csvFileName(registryName) + "." + csvFileName(name)
+	f := r.files[base]
+	if f == nil {
+		var err error
+		if f, err = r.open(base, now); err != nil {
+			return err
+		}
+		r.files[base] = f
+	}
+	if f.size > 0 && (!slices.Equal(f.header, header) || r.needsRotation(f, now)) {
+		delete(r.files, base)
+		if err := r.rotate(f, base, now); err != nil {
+			return err
+		}
+		var err error
+		if f, err = r.open(base, now); err != nil {
+			return err
+		}
+		r.files[base] = f
+	}
+
+	if f.size == 0 {
+		f.w.Write(header)
+		f.header = header
+	}
+	f.w.Write(append([]string{now.Format(time.RFC3339Nano)}, values...))
+	f.w.Flush()
+	return f.w.Error()
+}
+
+func (r *CSVReporter) needsRotation(f *csvFile, now time.Time) bool {
+	return (r.MaxSize > 0 && f.size >= r.MaxSize) ||
+		(r.MaxAge > 0 && now.Sub(f.created) >= r.MaxAge)
+}
+
+func (r *CSVReporter) open(base string, now time.Time) (*csvFile, error) {
+	file, err := os.OpenFile(r.path(base, ""), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f := &csvFile{
+		file:    file,
+		size:    info.Size(),
+		created: now,
+	}
+	f.w = csv.NewWriter(f)
+	if r.comma != 0 {
+		f.w.Comma = r.comma
+	}
+	if f.size > 0 {
+		f.header, f.created = r.readStart(base)
+		if f.created.IsZero() {
+			f.created = info.ModTime()
+		}
+	}
+	return f, nil
+}
+
+// readStart reads the header and the time of the first row of an
+// existing file. If the file cannot be parsed, nil and the zero time
+// will be returned.
+func (r *CSVReporter) readStart(base string) ([]string, time.Time) {
+	file, err := os.Open(r.path(base, ""))
+	if err != nil {
+		return nil, time.Time{}
+	}
+	defer file.Close()
+
+	cr := csv.NewReader(file)
+	if r.comma != 0 {
+		cr.Comma = r.comma
+	}
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, time.Time{}
+	}
+	row, err := cr.Read()
+	if err != nil || len(row) == 0 {
+		return header, time.Time{}
+	}
+	created, _ := time.Parse(time.RFC3339Nano, row[0])
+	return header, created
+}
+
+// path returns the path of the file with the given base name. Rotated
+// files additionally contain the given suffix.
+func (r *CSVReporter) path(base, suffix string) string {
+	ext := r.ext
+	if ext == "" {
+		ext = ".csv"
+	}
+	if suffix != "" {
+		base += "." + suffix
+	}
+	return filepath.Join(r.dir, base+ext)
+}
+
+// rotate closes the given file and moves it aside. If compression is
+// enabled, the rotated file is replaced by its gzipped version.
+func (r *CSVReporter) rotate(f *csvFile, base string, now time.Time) error {
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	path := r.path(base, "")
+	rotated := r.path(base, now.UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	if r.Compress {
+		return gzipFile(rotated)
+	}
+	return nil
+}
+
+type csvFile struct {
+	file    *os.File
+	w       *csv.Writer
+	header  []string
+	size    int64
+	created time.Time // time of the first row
+}
+
+func (f *csvFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *csvFile) close() error {
+	f.w.Flush()
+	if err := f.w.Error(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// gzipFile compresses the file at the given path into "<path>.gz" and
+// removes the original file.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// csvFileName replaces all characters of a metric or registry name which
+// are not allowed in file names.
+func csvFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < ' ', r == '/', r == '\\', r == ':', r == '*', r == '?', r == '"', r == '<', r == '>', r == '|':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func csvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
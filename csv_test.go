@@ -0,0 +1,241 @@
+package quant
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVReporter(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewCSVReporter(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.Quantiles = []float64{0.5}
+
+	reg := NewRegistry("reg")
+	counter := reg.NewCounter("requests")
+	reg.NewGauge("temperature", func() float64 { return 21.5 })
+	timer := reg.NewTimer("latency/db", Milliseconds)
+
+	counter.Add(3)
+	timer.Update(time.Millisecond)
+	timer.Update(3 * time.Millisecond)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	counter.Add(2)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+
+	rows := readCSV(t, filepath.Join(dir, "reg.requests.csv"), ',')
+	expectCSVRows(t, rows, [][]string{
+		{"time", "value"},
+		{"", "3"},
+		{"", "5"},
+	})
+
+	rows = readCSV(t, filepath.Join(dir, "reg.temperature.csv"), ',')
+	expectCSVRows(t, rows, [][]string{
+		{"time", "value"},
+		{"", "21.5"},
+		{"", "21.5"},
+	})
+
+	rows = readCSV(t, filepath.Join(dir, "reg.latency_db.csv"), ',')
+	expectCSVRows(t, rows, [][]string{
+		{"time", "count", "min", "max", "mean", "stddev", "p50"},
+		{"", "2", "1", "3", "2", "1", "2"},
+		{"", "0", "0", "0", "0", "0", "0"},
+	})
+	if _, err := time.Parse(time.RFC3339Nano, rows[1][0]); err != nil {
+		t.Errorf("invalid timestamp: %v", err)
+	}
+}
+
+func TestTSVReporterRotation(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewTSVReporter(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.MaxSize = 1
+	r.Compress = true
+	defer r.Close()
+
+	reg := NewRegistry("reg")
+	reg.NewSettableGauge("size").Set(7)
+	for i := 0; i < 3; i++ {
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "reg.size.*.tsv.gz"))
+	if len(rotated) != 2 {
+		t.Fatalf("wrong number of rotated files: %d (2 expected)", len(rotated))
+	}
+	for _, path := range rotated {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("invalid gzip file: %v", err)
+		}
+		data, _ := io.ReadAll(zr)
+		f.Close()
+		if !strings.HasPrefix(string(data), "time\tvalue\n") || strings.Count(string(data), "\n") != 2 {
+			t.Errorf("wrong rotated content: %q", data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "reg.size.tsv")); err != nil {
+		t.Errorf("missing current file: %v", err)
+	}
+	if uncompressed, _ := filepath.Glob(filepath.Join(dir, "reg.size.*.tsv")); len(uncompressed) != 0 {
+		t.Errorf("unexpected uncompressed files: %v", uncompressed)
+	}
+}
+
+func TestCSVReporterChangedColumns(t *testing.T) {
+	dir := t.TempDir()
+	reg := NewRegistry("reg")
+	reg.NewTimer("latency", Milliseconds).Update(time.Millisecond)
+
+	for _, q := range []float64{0.5, 0.5, 0.9} {
+		r, err := NewCSVReporter(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		r.Quantiles = []float64{q}
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "reg.latency.*.csv"))
+	if len(rotated) != 1 {
+		t.Fatalf("wrong number of rotated files: %d (1 expected)", len(rotated))
+	}
+	expectCSVRows(t, readCSV(t, rotated[0], ','), [][]string{
+		{"time", "count", "min", "max", "mean", "stddev", "p50"},
+		{"", "", "", "", "", "", ""},
+		{"", "", "", "", "", "", ""},
+	})
+	expectCSVRows(t, readCSV(t, filepath.Join(dir, "reg.latency.csv"), ','), [][]string{
+		{"time", "count", "min", "max", "mean", "stddev", "p90"},
+		{"", "", "", "", "", "", ""},
+	})
+}
+
+func TestCSVReporterMaxAgeOfExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "reg.size.csv")
+	old := time.Now().Add(-2 * time.Hour).Format(time.RFC3339Nano)
+	if err := os.WriteFile(path, []byte("time,value\n"+old+",1\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	r, err := NewCSVReporter(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r.MaxAge = time.Hour
+	defer r.Close()
+
+	reg := NewRegistry("reg")
+	reg.NewSettableGauge("size").Set(7)
+	for i := 0; i < 2; i++ {
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "reg.size.*.csv"))
+	if len(rotated) != 1 {
+		t.Fatalf("wrong number of rotated files: %d (1 expected)", len(rotated))
+	}
+	expectCSVRows(t, readCSV(t, rotated[0], ','), [][]string{
+		{"time", "value"},
+		{old, "1"},
+	})
+	expectCSVRows(t, readCSV(t, path, ','), [][]string{
+		{"time", "value"},
+		{"", "7"},
+		{"", "7"},
+	})
+}
+
+func TestCSVReporterZeroValue(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	reg := NewRegistry("reg")
+	reg.NewCounter("requests").Add(3)
+
+	var r CSVReporter
+	if err := reg.Report(&r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+
+	rows := readCSV(t, "reg.requests.csv", ',')
+	expectCSVRows(t, rows, [][]string{
+		{"time", "value"},
+		{"", "3"},
+	})
+}
+
+func readCSV(t *testing.T, path string, comma rune) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = comma
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv file: %v", err)
+	}
+	return rows
+}
+
+// expectCSVRows compares the rows with the expected rows. Empty expected
+// cells are not compared.
+func expectCSVRows(t *testing.T, rows, expected [][]string) {
+	t.Helper()
+	if len(rows) != len(expected) {
+		t.Fatalf("wrong number of rows: %d (%d expected)", len(rows), len(expected))
+	}
+	for i, row := range rows {
+		if len(row) != len(expected[i]) {
+			t.Errorf("wrong row %d: %v (%v expected)", i, row, expected[i])
+			continue
+		}
+		for j, cell := range row {
+			if expected[i][j] != "" && cell != expected[i][j] {
+				t.Errorf("wrong row %d: %v (%v expected)", i, row, expected[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package quant
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// deltaTracker remembers the counter values a registry reported to
+// each of its reporters. It is used to compute the counter deltas
+// since the last report of a registry/reporter pair.
+type deltaTracker struct {
+	mtx    sync.Mutex
+	states map[Reporter]*deltaState
+}
+
+type deltaState struct {
+	time   time.Time
+	values map[string]counterValue
+}
+
+type counterValue struct {
+	value      int64
+	floatValue float64
+}
+
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{
+		states: make(map[Reporter]*deltaState),
+	}
+}
+
+// track returns copies of the given counter snapshots which carry the
+// deltas since the last committed report to the given reporter.
+// Reporters that cannot be used as a map key are not tracked. For these
+// reporters, and for the first report of each counter, the delta equals
+// the value. The state is not changed until commit is called, so the
+// deltas of a failed report are included in the next one.
+func (t *deltaTracker) track(reporter Reporter, counters []*CounterSnapshot) []*CounterSnapshot {
+	res := make([]*CounterSnapshot, len(counters))
+	if !reflect.ValueOf(reporter).Comparable() {
+		for i, c := range counters {
+			res[i] = c.withDelta(c.value, c.floatValue, time.Time{})
+		}
+		return res
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	state := t.states[reporter]
+	for i, c := range counters {
+		if prev, ok := state.value(c.name); ok {
+			res[i] = c.withDelta(c.value-prev.value, c.floatValue-prev.floatValue, state.time)
+		} else {
+			res[i] = c.withDelta(c.value, c.floatValue, time.Time{})
+		}
+	}
+	return res
+}
+
+// commit remembers the counter values which were successfully reported
+// to the given reporter at the given time.
+func (t *deltaTracker) commit(reporter Reporter, now time.Time, counters []*CounterSnapshot) {
+	if !reflect.ValueOf(reporter).Comparable() {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	state := t.states[reporter]
+	if state == nil {
+		state = &deltaState{values: make(map[string]counterValue)}
+		t.states[reporter] = state
+	}
+	for _, c := range counters {
+		state.values[c.name] = counterValue{c.value, c.floatValue}
+	}
+	state.time = now
+}
+
+func (s *deltaState) value(name string) (counterValue, bool) {
+	if s == nil {
+		return counterValue{}, false
+	}
+	v, ok := s.values[name]
+	return v, ok
+}
+
+// forget drops the state of the given reporter.
+func (t *deltaTracker) forget(reporter Reporter) {
+	if !reflect.ValueOf(reporter).Comparable() {
+		return
+	}
+
+	t.mtx.Lock()
+	delete(t.states, reporter)
+	t.mtx.Unlock()
+}
@@ -0,0 +1,801 @@
+package quant
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// snapshotEncodingVersion is the version of the binary snapshot encoding.
+// It is written as the second byte of each encoded snapshot, after a byte
+// which identifies the snapshot type.
+const snapshotEncodingVersion = 1
+
+// Type identifiers of the binary snapshot encoding.
+const (
+	counterSnapshotKind   byte = 'c'
+	gaugeSnapshotKind     byte = 'g'
+	timerSnapshotKind     byte = 't'
+	histogramSnapshotKind byte = 'h'
+)
+
+var errInvalidSnapshot = errors.New("invalid snapshot encoding")
+
+// decodeGaugeError returns the error of a decoded gauge snapshot. The
+// sentinel errors of this package are restored, so that they can be
+// checked with errors.Is.
+func decodeGaugeError(msg string) error {
+	if msg == ErrReadTimeout.Error() {
+		return ErrReadTimeout
+	}
+	return errors.New(msg)
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (s *CounterSnapshot) MarshalBinary() ([]byte, error) {
+	e := newSnapshotEncoder(counterSnapshotKind, &s.snapshot)
+	e.bool(s.isFloat)
+	e.bool(s.monotonic)
+	e.varint(s.value)
+	e.float(s.floatValue)
+	e.varint(s.delta)
+	e.float(s.floatDelta)
+	e.time(s.time)
+	e.time(s.prevTime)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *CounterSnapshot) UnmarshalBinary(data []byte) error {
+	var snap CounterSnapshot
+	d := newSnapshotDecoder(data, counterSnapshotKind, &snap.snapshot)
+	snap.isFloat = d.bool()
+	snap.monotonic = d.bool()
+	snap.value = d.varint()
+	snap.floatValue = d.float()
+	snap.delta = d.varint()
+	snap.floatDelta = d.float()
+	snap.time = d.time()
+	snap.prevTime = d.time()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*s = snap
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The
+// error of a gauge is encoded as its message.
+func (s *GaugeSnapshot) MarshalBinary() ([]byte, error) {
+	e := newSnapshotEncoder(gaugeSnapshotKind, &s.snapshot)
+	e.bool(s.isInt)
+	e.float(s.value)
+	e.varint(s.intValue)
+	e.bool(s.err != nil)
+	if s.err != nil {
+		e.string(s.err.Error())
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *GaugeSnapshot) UnmarshalBinary(data []byte) error {
+	var snap GaugeSnapshot
+	d := newSnapshotDecoder(data, gaugeSnapshotKind, &snap.snapshot)
+	snap.isInt = d.bool()
+	snap.value = d.float()
+	snap.intValue = d.varint()
+	if d.bool() {
+		snap.err = decodeGaugeError(d.string())
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*s = snap
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (s *TimerSnapshot) MarshalBinary() ([]byte, error) {
+	e := newSnapshotEncoder(timerSnapshotKind, &s.snapshot)
+	e.reservoir(&s.reservoirSnapshot)
+	e.bool(s.exemplar != nil)
+	if s.exemplar != nil {
+		e.string(s.exemplar.TraceID)
+		e.float(s.exemplar.Value)
+		e.time(s.exemplar.Time)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *TimerSnapshot) UnmarshalBinary(data []byte) error {
+	var snap TimerSnapshot
+	d := newSnapshotDecoder(data, timerSnapshotKind, &snap.snapshot)
+	d.reservoir(&snap.reservoirSnapshot)
+	if d.bool() {
+		snap.exemplar = &Exemplar{
+			TraceID: d.string(),
+			Value:   d.float(),
+			Time:    d.time(),
+		}
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*s = snap
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (s *HistogramSnapshot) MarshalBinary() ([]byte, error) {
+	e := newSnapshotEncoder(histogramSnapshotKind, &s.snapshot)
+	e.reservoir(&s.reservoirSnapshot)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (s *HistogramSnapshot) UnmarshalBinary(data []byte) error {
+	var snap HistogramSnapshot
+	d := newSnapshotDecoder(data, histogramSnapshotKind, &snap.snapshot)
+	d.reservoir(&snap.reservoirSnapshot)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*s = snap
+	return nil
+}
+
+type snapshotEncoder struct {
+	buf []byte
+}
+
+func newSnapshotEncoder(kind byte, s *snapshot) *snapshotEncoder {
+	e := &snapshotEncoder{buf: []byte{kind, snapshotEncodingVersion}}
+	e.string(s.name)
+	e.string(s.unit)
+	return e
+}
+
+func (e *snapshotEncoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *snapshotEncoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *snapshotEncoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *snapshotEncoder) float(v float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *snapshotEncoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// time encodes a point in time as nanoseconds since the Unix epoch. The
+// zero time is encoded as zero.
+func (e *snapshotEncoder) time(t time.Time) {
+	if t.IsZero() {
+		e.varint(0)
+	} else {
+		e.varint(t.UnixNano())
+	}
+}
+
+func (e *snapshotEncoder) reservoir(s *reservoirSnapshot) {
+	e.uvarint(uint64(s.count))
+	e.float(s.min)
+	e.float(s.max)
+	e.float(s.sum)
+	e.float(s.mean)
+	e.float(s.m2)
+	e.uvarint(uint64(len(s.sample)))
+	for _, v := range s.sample {
+		e.float(v)
+	}
+	e.bool(s.sketch != nil)
+	if s.sketch != nil {
+		e.float(s.sketch.alpha)
+		e.uvarint(s.sketch.zero)
+		e.ddStore(&s.sketch.pos)
+		e.ddStore(&s.sketch.neg)
+	}
+	e.bool(s.hdr != nil)
+	if s.hdr != nil {
+		e.varint(s.hdr.layout.highest)
+		e.uvarint(uint64(s.hdr.layout.digits))
+		e.float(s.hdr.scale)
+		e.uvarint(uint64(len(s.hdr.indexes)))
+		prev := 0
+		for i, idx := range s.hdr.indexes {
+			e.uvarint(uint64(idx - prev))
+			e.uvarint(s.hdr.counts[i])
+			prev = idx
+		}
+	}
+	e.bool(s.buckets != nil)
+	if s.buckets != nil {
+		e.uvarint(uint64(len(s.buckets.bounds)))
+		for _, b := range s.buckets.bounds {
+			e.float(b)
+		}
+		for _, n := range s.buckets.counts {
+			e.uvarint(n)
+		}
+	}
+}
+
+func (e *snapshotEncoder) ddStore(s *ddStore) {
+	e.varint(int64(s.offset))
+	e.uvarint(uint64(len(s.bins)))
+	for _, n := range s.bins {
+		e.uvarint(n)
+	}
+}
+
+// snapshotDecoder decodes the values written by a snapshotEncoder. After
+// the first error all subsequent reads return zero values, so the error
+// only needs to be checked once at the end.
+type snapshotDecoder struct {
+	buf []byte
+	err error
+}
+
+func newSnapshotDecoder(data []byte, kind byte, s *snapshot) *snapshotDecoder {
+	d := &snapshotDecoder{buf: data}
+	if len(data) < 2 || data[0] != kind || data[1] != snapshotEncodingVersion {
+		d.err = errInvalidSnapshot
+		return d
+	}
+	d.buf = data[2:]
+	s.name = d.string()
+	s.unit = d.string()
+	return d
+}
+
+func (d *snapshotDecoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		return errInvalidSnapshot
+	}
+	return d.err
+}
+
+func (d *snapshotDecoder) bool() bool {
+	if d.err != nil || len(d.buf) == 0 {
+		d.err = errInvalidSnapshot
+		return false
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b != 0
+}
+
+func (d *snapshotDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errInvalidSnapshot
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *snapshotDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errInvalidSnapshot
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *snapshotDecoder) float() float64 {
+	if d.err != nil || len(d.buf) < 8 {
+		d.err = errInvalidSnapshot
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *snapshotDecoder) string() string {
+	n := d.uvarint()
+	if d.err != nil || uint64(len(d.buf)) < n {
+		d.err = errInvalidSnapshot
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *snapshotDecoder) time() time.Time {
+	if ns := d.varint(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+func (d *snapshotDecoder) reservoir(s *reservoirSnapshot) {
+	if count := d.uvarint(); count <= math.MaxInt {
+		s.count = int(count)
+	} else {
+		d.err = errInvalidSnapshot
+	}
+	s.min = d.float()
+	s.max = d.float()
+	s.sum = d.float()
+	s.mean = d.float()
+	s.m2 = d.float()
+	n := d.uvarint()
+	if d.err != nil || n > reservoirSize || n > uint64(s.count) || uint64(len(d.buf)) < 8*n {
+		d.err = errInvalidSnapshot
+		return
+	}
+	s.sample = make([]float64, n)
+	for i := range s.sample {
+		s.sample[i] = d.float()
+	}
+	s.sortSample()
+
+	if d.bool() {
+		alpha := d.float()
+		if !(alpha > 0 && alpha < 1) {
+			d.err = errInvalidSnapshot
+			return
+		}
+		s.sketch = newDDSketch(alpha)
+		s.sketch.zero = d.uvarint()
+		d.ddStore(&s.sketch.pos)
+		d.ddStore(&s.sketch.neg)
+		if d.err == nil && !s.sketch.valid(uint64(s.count)) {
+			d.err = errInvalidSnapshot
+			return
+		}
+	}
+
+	if d.bool() {
+		highest, digits, scale := d.varint(), d.uvarint(), d.float()
+		n := d.uvarint()
+		if d.err != nil || !validHDRConfig(highest, digits, scale) || uint64(len(d.buf)) < 2*n {
+			d.err = errInvalidSnapshot
+			return
+		}
+		h := &hdrHistogram{
+			layout:  newHDRLayout(highest, int(digits)),
+			scale:   scale,
+			indexes: make([]int, n),
+			counts:  make([]uint64, n),
+		}
+		idx := uint64(0)
+		for i := range h.indexes {
+			idx += d.uvarint()
+			if idx >= uint64(h.layout.countsLen) || (i > 0 && int(idx) == h.indexes[i-1]) {
+				d.err = errInvalidSnapshot
+				return
+			}
+			h.indexes[i] = int(idx)
+			h.counts[i] = d.uvarint()
+		}
+		s.hdr = h
+	}
+
+	if d.bool() {
+		n := d.uvarint()
+		if d.err != nil || n == 0 || uint64(len(d.buf)) < 9*n+1 {
+			d.err = errInvalidSnapshot
+			return
+		}
+		bounds := make([]float64, n)
+		for i := range bounds {
+			bounds[i] = d.float()
+		}
+		if !validBuckets(bounds) {
+			d.err = errInvalidSnapshot
+			return
+		}
+		s.buckets = newBucketCounts(bounds)
+		for i := range s.buckets.counts {
+			s.buckets.counts[i] = d.uvarint()
+		}
+	}
+}
+
+func validHDRConfig(highest int64, digits uint64, scale float64) bool {
+	return highest >= 2 && digits >= 1 && digits <= 5 && scale > 0 && !math.IsInf(scale, 0)
+}
+
+func (d *snapshotDecoder) ddStore(s *ddStore) {
+	s.offset = int(d.varint())
+	n := d.uvarint()
+	if d.err != nil || n > ddMaxBins || uint64(len(d.buf)) < n {
+		d.err = errInvalidSnapshot
+		return
+	}
+	s.bins = make([]uint64, n)
+	for i := range s.bins {
+		s.bins[i] = d.uvarint()
+	}
+}
+
+// snapshotFloat is a float64 which is encoded as a JSON string if it
+// cannot be represented as a JSON number ("NaN", "+Inf", "-Inf").
+type snapshotFloat float64
+
+func (f snapshotFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+func (f *snapshotFloat) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errInvalidSnapshot
+		}
+		*f = snapshotFloat(v)
+		return nil
+	}
+
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = snapshotFloat(v)
+	return nil
+}
+
+// jsonValue encodes an integer or a float value as a JSON number.
+func jsonValue(isFloat bool, i int64, f float64) json.RawMessage {
+	if isFloat {
+		data, _ := snapshotFloat(f).MarshalJSON()
+		return data
+	}
+	return strconv.AppendInt(nil, i, 10)
+}
+
+// parseJSONValue decodes a value encoded by jsonValue.
+func parseJSONValue(data json.RawMessage, isFloat bool) (int64, float64, error) {
+	if isFloat {
+		var f snapshotFloat
+		if err := f.UnmarshalJSON(data); err != nil {
+			return 0, 0, err
+		}
+		return int64(f), float64(f), nil
+	}
+
+	var i int64
+	if err := json.Unmarshal(data, &i); err != nil {
+		return 0, 0, err
+	}
+	return i, float64(i), nil
+}
+
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func parseJSONTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+type counterSnapshotJSON struct {
+	Name         string          `json:"name"`
+	Unit         string          `json:"unit,omitempty"`
+	Value        json.RawMessage `json:"value"`
+	Delta        json.RawMessage `json:"delta"`
+	Float        bool            `json:"float,omitempty"`
+	Monotonic    bool            `json:"monotonic,omitempty"`
+	Time         *time.Time      `json:"time,omitempty"`
+	PreviousTime *time.Time      `json:"previous_time,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s *CounterSnapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(counterSnapshotJSON{
+		Name:         s.name,
+		Unit:         s.unit,
+		Value:        jsonValue(s.isFloat, s.value, s.floatValue),
+		Delta:        jsonValue(s.isFloat, s.delta, s.floatDelta),
+		Float:        s.isFloat,
+		Monotonic:    s.monotonic,
+		Time:         jsonTime(s.time),
+		PreviousTime: jsonTime(s.prevTime),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *CounterSnapshot) UnmarshalJSON(data []byte) error {
+	var v counterSnapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	snap := CounterSnapshot{
+		snapshot:  snapshot{v.Name, v.Unit},
+		isFloat:   v.Float,
+		monotonic: v.Monotonic,
+		time:      parseJSONTime(v.Time),
+		prevTime:  parseJSONTime(v.PreviousTime),
+	}
+	var err error
+	if snap.value, snap.floatValue, err = parseJSONValue(v.Value, v.Float); err != nil {
+		return err
+	}
+	if snap.delta, snap.floatDelta, err = parseJSONValue(v.Delta, v.Float); err != nil {
+		return err
+	}
+	*s = snap
+	return nil
+}
+
+type gaugeSnapshotJSON struct {
+	Name  string          `json:"name"`
+	Unit  string          `json:"unit,omitempty"`
+	Value json.RawMessage `json:"value"`
+	Int   bool            `json:"int,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface. The error of a
+// gauge is encoded as its message.
+func (s *GaugeSnapshot) MarshalJSON() ([]byte, error) {
+	v := gaugeSnapshotJSON{
+		Name:  s.name,
+		Unit:  s.unit,
+		Value: jsonValue(!s.isInt, s.intValue, s.value),
+		Int:   s.isInt,
+	}
+	if s.err != nil {
+		v.Error = s.err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *GaugeSnapshot) UnmarshalJSON(data []byte) error {
+	var v gaugeSnapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	snap := GaugeSnapshot{
+		snapshot: snapshot{v.Name, v.Unit},
+		isInt:    v.Int,
+	}
+	var err error
+	if snap.intValue, snap.value, err = parseJSONValue(v.Value, !v.Int); err != nil {
+		return err
+	}
+	if v.Error != "" {
+		snap.err = decodeGaugeError(v.Error)
+	}
+	*s = snap
+	return nil
+}
+
+type reservoirSnapshotJSON struct {
+	Name    string          `json:"name"`
+	Unit    string          `json:"unit,omitempty"`
+	Count   int             `json:"count"`
+	Min     snapshotFloat   `json:"min"`
+	Max     snapshotFloat   `json:"max"`
+	Sum     snapshotFloat   `json:"sum"`
+	Mean    snapshotFloat   `json:"mean"`
+	M2      snapshotFloat   `json:"m2"`
+	Sample  []snapshotFloat `json:"sample,omitempty"`
+	Sketch  *sketchJSON     `json:"sketch,omitempty"`
+	HDR     *hdrJSON        `json:"hdr,omitempty"`
+	Buckets *bucketsJSON    `json:"buckets,omitempty"`
+}
+
+type bucketsJSON struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+}
+
+type hdrJSON struct {
+	Highest           int64    `json:"highest"`
+	SignificantDigits int      `json:"significant_digits"`
+	Scale             float64  `json:"scale"`
+	Indexes           []int    `json:"indexes"`
+	Counts            []uint64 `json:"counts"`
+}
+
+type sketchJSON struct {
+	RelativeAccuracy float64     `json:"relative_accuracy"`
+	Zero             uint64      `json:"zero,omitempty"`
+	Positive         ddStoreJSON `json:"positive"`
+	Negative         ddStoreJSON `json:"negative"`
+}
+
+type ddStoreJSON struct {
+	Offset int      `json:"offset"`
+	Bins   []uint64 `json:"bins"`
+}
+
+func newReservoirSnapshotJSON(s *reservoirSnapshot) reservoirSnapshotJSON {
+	v := reservoirSnapshotJSON{
+		Name:   s.name,
+		Unit:   s.unit,
+		Count:  s.count,
+		Min:    snapshotFloat(s.min),
+		Max:    snapshotFloat(s.max),
+		Sum:    snapshotFloat(s.sum),
+		Mean:   snapshotFloat(s.mean),
+		M2:     snapshotFloat(s.m2),
+		Sample: make([]snapshotFloat, len(s.sample)),
+	}
+	for i, x := range s.sample {
+		v.Sample[i] = snapshotFloat(x)
+	}
+	if s.sketch != nil {
+		v.Sketch = &sketchJSON{
+			RelativeAccuracy: s.sketch.alpha,
+			Zero:             s.sketch.zero,
+			Positive:         ddStoreJSON{s.sketch.pos.offset, s.sketch.pos.bins},
+			Negative:         ddStoreJSON{s.sketch.neg.offset, s.sketch.neg.bins},
+		}
+	}
+	if s.hdr != nil {
+		v.HDR = &hdrJSON{
+			Highest:           s.hdr.layout.highest,
+			SignificantDigits: s.hdr.layout.digits,
+			Scale:             s.hdr.scale,
+			Indexes:           s.hdr.indexes,
+			Counts:            s.hdr.counts,
+		}
+	}
+	if s.buckets != nil {
+		v.Buckets = &bucketsJSON{s.buckets.bounds, s.buckets.counts}
+	}
+	return v
+}
+
+func (v *reservoirSnapshotJSON) snapshot() (reservoirSnapshot, error) {
+	if v.Count < 0 || len(v.Sample) > reservoirSize || len(v.Sample) > v.Count {
+		return reservoirSnapshot{}, errInvalidSnapshot
+	}
+	s := reservoirSnapshot{
+		snapshot: snapshot{v.Name, v.Unit},
+		count:    v.Count,
+		min:      float64(v.Min),
+		max:      float64(v.Max),
+		sum:      float64(v.Sum),
+		mean:     float64(v.Mean),
+		m2:       float64(v.M2),
+		sample:   make([]float64, len(v.Sample)),
+	}
+	for i, x := range v.Sample {
+		s.sample[i] = float64(x)
+	}
+	s.sortSample()
+	if sk := v.Sketch; sk != nil {
+		if !(sk.RelativeAccuracy > 0 && sk.RelativeAccuracy < 1) {
+			return reservoirSnapshot{}, errInvalidSnapshot
+		}
+		s.sketch = newDDSketch(sk.RelativeAccuracy)
+		s.sketch.zero = sk.Zero
+		s.sketch.pos = ddStore{sk.Positive.Offset, sk.Positive.Bins}
+		s.sketch.neg = ddStore{sk.Negative.Offset, sk.Negative.Bins}
+		if !s.sketch.valid(uint64(v.Count)) {
+			return reservoirSnapshot{}, errInvalidSnapshot
+		}
+	}
+	if h := v.HDR; h != nil {
+		if !validHDRConfig(h.Highest, uint64(h.SignificantDigits), h.Scale) || len(h.Indexes) != len(h.Counts) {
+			return reservoirSnapshot{}, errInvalidSnapshot
+		}
+		layout := newHDRLayout(h.Highest, h.SignificantDigits)
+		for i, idx := range h.Indexes {
+			if idx < 0 || idx >= layout.countsLen || (i > 0 && idx <= h.Indexes[i-1]) {
+				return reservoirSnapshot{}, errInvalidSnapshot
+			}
+		}
+		s.hdr = &hdrHistogram{layout, h.Scale, h.Indexes, h.Counts}
+	}
+	if b := v.Buckets; b != nil {
+		if len(b.Bounds) == 0 || len(b.Counts) != len(b.Bounds)+1 || !validBuckets(b.Bounds) {
+			return reservoirSnapshot{}, errInvalidSnapshot
+		}
+		s.buckets = &bucketCounts{b.Bounds, b.Counts}
+	}
+	return s, nil
+}
+
+type exemplarJSON struct {
+	TraceID string        `json:"trace_id"`
+	Value   snapshotFloat `json:"value"`
+	Time    time.Time     `json:"time"`
+}
+
+type timerSnapshotJSON struct {
+	reservoirSnapshotJSON
+	Exemplar *exemplarJSON `json:"exemplar,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s *TimerSnapshot) MarshalJSON() ([]byte, error) {
+	v := timerSnapshotJSON{
+		reservoirSnapshotJSON: newReservoirSnapshotJSON(&s.reservoirSnapshot),
+	}
+	if e := s.exemplar; e != nil {
+		v.Exemplar = &exemplarJSON{e.TraceID, snapshotFloat(e.Value), e.Time}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *TimerSnapshot) UnmarshalJSON(data []byte) error {
+	var v timerSnapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	res, err := v.snapshot()
+	if err != nil {
+		return err
+	}
+	snap := TimerSnapshot{reservoirSnapshot: res}
+	if e := v.Exemplar; e != nil {
+		snap.exemplar = &Exemplar{e.TraceID, float64(e.Value), e.Time}
+	}
+	*s = snap
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s *HistogramSnapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newReservoirSnapshotJSON(&s.reservoirSnapshot))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *HistogramSnapshot) UnmarshalJSON(data []byte) error {
+	var v reservoirSnapshotJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	res, err := v.snapshot()
+	if err != nil {
+		return err
+	}
+	*s = HistogramSnapshot{reservoirSnapshot: res}
+	return nil
+}
@@ -0,0 +1,152 @@
+package quant
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSnapshots() []interface {
+	encoding.BinaryMarshaler
+	json.Marshaler
+} {
+	now := time.Unix(1700000000, 123)
+	counter := NewCounterSnapshot("requests", "", 42, true).WithDelta(2, now)
+	counter.time = now.Add(time.Second)
+
+	timer := NewTimerSnapshot("latency", "ms", 1, 2, 3)
+	timer.exemplar = &Exemplar{TraceID: "abc", Value: 2, Time: now}
+
+	return []interface {
+		encoding.BinaryMarshaler
+		json.Marshaler
+	}{
+		counter,
+		NewFloatCounterSnapshot("cpu", "s", 1.5, false),
+		NewGaugeSnapshot("temperature", "", math.NaN()),
+		NewIntGaugeSnapshot("goroutines", "", math.MaxInt64),
+		NewFailedGaugeSnapshot("broken", "B", errors.New("read error")),
+		timer,
+		NewTimerSnapshot("empty", "s"),
+		NewHistogramSnapshot("size", "B", 10, math.Inf(1)),
+	}
+}
+
+func TestSnapshotBinaryEncoding(t *testing.T) {
+	for _, snap := range testSnapshots() {
+		data, err := snap.MarshalBinary()
+		if err != nil {
+			t.Fatalf("unexpected marshal error: %v", err)
+		}
+		decoded := reflect.New(reflect.TypeOf(snap).Elem()).Interface().(encoding.BinaryUnmarshaler)
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("unexpected unmarshal error: %v", err)
+		}
+		expectEqualSnapshots(t, decoded, snap)
+
+		if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Errorf("truncated data accepted for %T", snap)
+		}
+	}
+
+	var timer TimerSnapshot
+	data, _ := NewCounterSnapshot("c", "", 1, false).MarshalBinary()
+	if err := timer.UnmarshalBinary(data); err == nil {
+		t.Error("counter data accepted as timer")
+	}
+}
+
+func TestSnapshotJSONEncoding(t *testing.T) {
+	for _, snap := range testSnapshots() {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			t.Fatalf("unexpected marshal error: %v", err)
+		}
+		decoded := reflect.New(reflect.TypeOf(snap).Elem()).Interface()
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("unexpected unmarshal error for %s: %v", data, err)
+		}
+		expectEqualSnapshots(t, decoded, snap)
+	}
+
+	data, _ := json.Marshal(NewIntGaugeSnapshot("goroutines", "", 12))
+	if expected := `{"name":"goroutines","value":12,"int":true}`; string(data) != expected {
+		t.Errorf("wrong json: %s (%s expected)", data, expected)
+	}
+}
+
+func TestGaugeSnapshotEncodingSentinelError(t *testing.T) {
+	snap := NewFailedGaugeSnapshot("slow", "", ErrReadTimeout)
+
+	data, _ := snap.MarshalBinary()
+	var decoded GaugeSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if !errors.Is(decoded.Err(), ErrReadTimeout) {
+		t.Errorf("wrong binary decoded error: %v (%v expected)", decoded.Err(), ErrReadTimeout)
+	}
+
+	data, _ = json.Marshal(snap)
+	decoded = GaugeSnapshot{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if !errors.Is(decoded.Err(), ErrReadTimeout) {
+		t.Errorf("wrong json decoded error: %v (%v expected)", decoded.Err(), ErrReadTimeout)
+	}
+}
+
+func TestTimerSnapshotEncodingCountOverflow(t *testing.T) {
+	snap := NewTimerSnapshot("latency", "ms")
+	data, _ := snap.MarshalBinary()
+
+	// replace the count by a value which does not fit into an int
+	prefix := newSnapshotEncoder(timerSnapshotKind, &snap.snapshot).buf
+	e := &snapshotEncoder{buf: append([]byte(nil), prefix...)}
+	e.uvarint(math.MaxUint64)
+	data = append(e.buf, data[len(prefix)+1:]...)
+
+	var decoded TimerSnapshot
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Errorf("count overflow accepted: %d", decoded.Count())
+	}
+}
+
+// expectEqualSnapshots compares two snapshots by their exported methods.
+func expectEqualSnapshots(t *testing.T, snap, expected interface{}) {
+	t.Helper()
+	v, exp := reflect.ValueOf(snap), reflect.ValueOf(expected)
+	for i := 0; i < exp.NumMethod(); i++ {
+		m := exp.Type().Method(i)
+		if m.Type.NumIn() != 1 || m.Type.NumOut() != 1 || m.Name == "MarshalBinary" || m.Name == "MarshalJSON" {
+			continue
+		}
+		res := v.Method(i).Call(nil)[0].Interface()
+		expRes := exp.Method(i).Call(nil)[0].Interface()
+		if !snapshotValuesEqual(res, expRes) {
+			t.Errorf("wrong %s of %T: %v (%v expected)", m.Name, snap, res, expRes)
+		}
+	}
+}
+
+func snapshotValuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		b := b.(float64)
+		return a == b || (math.IsNaN(a) && math.IsNaN(b))
+	case time.Time:
+		return a.Equal(b.(time.Time))
+	case error:
+		b, _ := b.(error)
+		return b != nil && a.Error() == b.Error()
+	case *Exemplar:
+		b := b.(*Exemplar)
+		return (a == nil) == (b == nil) && (a == nil || (a.TraceID == b.TraceID && a.Value == b.Value && a.Time.Equal(b.Time)))
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,220 @@
+package quant
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// ExpvarReporter is a Reporter implementation that publishes the
+// metric snapshots through the expvar package, i.e. they are served
+// under /debug/vars by the default HTTP handler. The published value
+// is a JSON object keyed by the registry names. Each registry is an
+// object keyed by the metric names. Counters and gauges are published
+// as plain numbers, whereas timers and histograms are published as
+// objects containing their statistics. Timers and histograms with
+// explicit buckets additionally contain the cumulative bucket counts as
+// a list of objects with the upper bound "le" as string, like the "le"
+// label of Prometheus, and the "count". Each report replaces the
+// published values of the reported metric type, i.e. metrics which are
+// not part of a report anymore are not published anymore.
+type ExpvarReporter struct {
+	mtx        sync.RWMutex
+	registries map[string]*[numExpvarTypes]map[string]interface{}
+}
+
+// The metric types of a registry, which are published separately.
+const (
+	expvarCounters = iota
+	expvarGauges
+	expvarTimers
+	expvarHistograms
+	numExpvarTypes
+)
+
+// NewExpvarReporter creates a new expvar reporter and publishes it under
+// the given name. If the name is already in use this function will panic.
+func NewExpvarReporter(name string) *ExpvarReporter {
+	r := &ExpvarReporter{
+		registries: make(map[string]*[numExpvarTypes]map[string]interface{}),
+	}
+	expvar.Publish(name, r)
+	return r
+}
+
+// String returns the JSON representation of the published snapshots.
+// It implements the expvar.Var interface.
+func (r *ExpvarReporter) String() string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	registries := make(map[string]map[string]interface{}, len(r.registries))
+	for name, types := range r.registries {
+		values := make(map[string]interface{})
+		for _, typeValues := range types {
+			for metric, v := range typeValues {
+				values[metric] = v
+			}
+		}
+		registries[name] = values
+	}
+	data, err := json.Marshal(registries)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// ReportCounters publishes the counter snapshots.
+func (r *ExpvarReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	values := make(map[string]interface{}, len(counters))
+	for _, c := range counters {
+		if c.IsFloat() {
+			values[c.Name()] = jsonFloat(c.FloatValue())
+		} else {
+			values[c.Name()] = c.Value()
+		}
+	}
+	r.publish(registryName, expvarCounters, values)
+	return nil
+}
+
+// ReportGauges publishes the gauge snapshots. Gauges which could not
+// be read are published as null.
+func (r *ExpvarReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	values := make(map[string]interface{}, len(gauges))
+	for _, g := range gauges {
+		if g.IsInt() && g.Err() == nil {
+			values[g.Name()] = g.IntValue()
+		} else {
+			values[g.Name()] = jsonFloat(g.Value())
+		}
+	}
+	r.publish(registryName, expvarGauges, values)
+	return nil
+}
+
+// ReportTimers publishes the timer snapshots.
+func (r *ExpvarReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	values := make(map[string]interface{}, len(timers))
+	for _, t := range timers {
+		values[t.Name()] = reservoirValues(&t.reservoirSnapshot)
+	}
+	r.publish(registryName, expvarTimers, values)
+	return nil
+}
+
+// ReportHistograms publishes the histogram snapshots.
+func (r *ExpvarReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	values := make(map[string]interface{}, len(histograms))
+	for _, h := range histograms {
+		values[h.Name()] = reservoirValues(&h.reservoirSnapshot)
+	}
+	r.publish(registryName, expvarHistograms, values)
+	return nil
+}
+
+// publish replaces the published values of the given registry and
+// metric type.
+func (r *ExpvarReporter) publish(registryName string, typ int, values map[string]interface{}) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.registries == nil {
+		r.registries = make(map[string]*[numExpvarTypes]map[string]interface{})
+	}
+	types := r.registries[registryName]
+	if types == nil {
+		types = new([numExpvarTypes]map[string]interface{})
+		r.registries[registryName] = types
+	}
+	types[typ] = values
+}
+
+func reservoirValues(s *reservoirSnapshot) map[string]interface{} {
+	values := map[string]interface{}{
+		"unit":   s.Unit(),
+		"count":  s.Count(),
+		"min":    jsonFloat(s.Minimum()),
+		"max":    jsonFloat(s.Maximum()),
+		"mean":   jsonFloat(s.Average()),
+		"stddev": jsonFloat(s.StdDeviation()),
+	}
+	if s.buckets != nil {
+		buckets := s.CumulativeBuckets()
+		list := make([]map[string]interface{}, len(buckets))
+		for i, b := range buckets {
+			list[i] = map[string]interface{}{
+				"le":    promFloat(b.UpperBound),
+				"count": b.Count,
+			}
+		}
+		values["buckets"] = list
+	}
+	return values
+}
+
+// jsonFloat returns nil for values which cannot be represented in JSON
+// (NaN and infinity), and the value itself otherwise.
+func jsonFloat(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
+
+// ImportExpvar registers a gauge for each numeric variable published
+// through the expvar package. The gauge names consist of the given prefix
+// followed by the variable name. Int variables are registered as IntGauge,
+// all other variables with a numeric JSON representation as Gauge. For
+// expvar.Map variables a gauge is registered for each numeric entry, named
+// "<variable>.<key>". Variables published after the import are not taken
+// into account. Names which already exist in the registry are skipped.
+func ImportExpvar(registry *Registry, prefix string) {
+	expvar.Do(func(kv expvar.KeyValue) {
+		importExpvar(registry, prefix+kv.Key, kv.Value)
+	})
+}
+
+func importExpvar(registry *Registry, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		registry.intGaugeOrNewIfFree(name, v.Value)
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			key := kv.Key
+			entry := name + "." + key
+			if _, ok := parseExpvar(kv.Value); ok {
+				registry.gaugeOrNewIfFree(entry, func() float64 {
+					if val, ok := parseExpvar(v.Get(key)); ok {
+						return val
+					}
+					return math.NaN()
+				})
+			}
+		})
+	default:
+		if _, ok := parseExpvar(v); ok {
+			registry.gaugeOrNewIfFree(name, func() float64 {
+				val, _ := parseExpvar(v)
+				return val
+			})
+		}
+	}
+}
+
+// parseExpvar returns the numeric value of an expvar variable. If the
+// variable does not have a numeric JSON representation, NaN and false
+// will be returned.
+func parseExpvar(v expvar.Var) (float64, bool) {
+	if v == nil {
+		return math.NaN(), false
+	}
+	val, err := strconv.ParseFloat(v.String(), 64)
+	if err != nil {
+		return math.NaN(), false
+	}
+	return val, true
+}
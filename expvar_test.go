@@ -0,0 +1,160 @@
+package quant
+
+import (
+	"encoding/json"
+	"expvar"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var expvarTestRuns atomic.Int64
+
+// uniqueExpvarName appends a sequence number to the given name, since
+// expvar does not allow to publish a name twice, e.g. with -count.
+func uniqueExpvarName(name string) string {
+	return name + "-" + strconv.FormatInt(expvarTestRuns.Add(1), 10)
+}
+
+func TestExpvarReporter(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("my-counter").Add(3)
+	reg.NewGauge("my-gauge", func() float64 { return 1.5 })
+	reg.NewTimer("my-timer", Milliseconds).Update(2000000)
+	reg.NewBucketedTimer("my-bucketed-timer", Milliseconds, []float64{1}).Update(2000000)
+
+	name := uniqueExpvarName("quant-test-reporter")
+	r := NewExpvarReporter(name)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	var vars map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &vars); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	metrics := vars["reg"]
+	if metrics["my-counter"] != 3.0 {
+		t.Errorf("wrong counter value: %v (3 expected)", metrics["my-counter"])
+	}
+	if metrics["my-gauge"] != 1.5 {
+		t.Errorf("wrong gauge value: %v (1.5 expected)", metrics["my-gauge"])
+	}
+	timer, _ := metrics["my-timer"].(map[string]interface{})
+	if timer["count"] != 1.0 || timer["mean"] != 2.0 || timer["unit"] != "ms" {
+		t.Errorf("wrong timer values: %v", timer)
+	}
+	if _, has := timer["buckets"]; has {
+		t.Errorf("buckets published for timer without buckets: %v", timer)
+	}
+	timer, _ = metrics["my-bucketed-timer"].(map[string]interface{})
+	buckets, _ := json.Marshal(timer["buckets"])
+	if expected := `[{"count":0,"le":"1"},{"count":1,"le":"+Inf"}]`; string(buckets) != expected {
+		t.Errorf("wrong timer buckets: %s (%s expected)", buckets, expected)
+	}
+}
+
+func TestExpvarReporterReplacesValues(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("old-counter").Add(1)
+	reg.NewGauge("my-gauge", func() float64 { return 1 })
+
+	r := NewExpvarReporter(uniqueExpvarName("quant-test-replace"))
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	reg = NewRegistry("reg")
+	reg.NewCounter("new-counter").Add(2)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	var vars map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(r.String()), &vars); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	metrics := vars["reg"]
+	if _, has := metrics["old-counter"]; has {
+		t.Errorf("stale counter still published: %v", metrics)
+	}
+	if metrics["new-counter"] != 2.0 {
+		t.Errorf("wrong counter value: %v (2 expected)", metrics["new-counter"])
+	}
+	if metrics["my-gauge"] != 1.0 {
+		t.Errorf("wrong gauge value: %v (1 expected)", metrics["my-gauge"])
+	}
+}
+
+func TestExpvarReporterZeroValue(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("my-counter").Add(3)
+
+	var r ExpvarReporter
+	if err := reg.Report(&r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if s, expected := r.String(), `{"reg":{"my-counter":3}}`; s != expected {
+		t.Errorf("wrong published values: %s (%s expected)", s, expected)
+	}
+}
+
+func TestImportExpvar(t *testing.T) {
+	intName := uniqueExpvarName("quant-test-int")
+	floatName := uniqueExpvarName("quant-test-float")
+	stringName := uniqueExpvarName("quant-test-string")
+	mapName := uniqueExpvarName("quant-test-map")
+	expvar.NewInt(intName).Set(7)
+	expvar.NewFloat(floatName).Set(0.5)
+	expvar.NewString(stringName).Set("text")
+	m := expvar.NewMap(mapName)
+	m.Add("a", 2)
+	m.AddFloat("b", 1.5)
+
+	reg := NewRegistry("reg")
+	ImportExpvar(reg, "ext.")
+
+	if g := reg.IntGauge("ext." + intName); g == nil || g.Value() != 7 {
+		t.Error("int variable not imported")
+	}
+	if g := reg.Gauge("ext." + floatName); g == nil || g.Value() != 0.5 {
+		t.Error("float variable not imported")
+	}
+	if reg.Contains("ext." + stringName) {
+		t.Error("string variable imported")
+	}
+	if g := reg.Gauge("ext." + mapName + ".b"); g == nil || g.Value() != 1.5 {
+		t.Error("map entry not imported")
+	}
+
+	// importing twice must not panic
+	ImportExpvar(reg, "ext.")
+}
+
+func TestImportExpvarConcurrent(t *testing.T) {
+	name := uniqueExpvarName("quant-test-concurrent")
+	taken := uniqueExpvarName("quant-test-taken")
+	expvar.NewInt(name).Set(1)
+	expvar.NewInt(taken).Set(2)
+
+	reg := NewRegistry("reg")
+	reg.NewCounter("ext." + taken)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ImportExpvar(reg, "ext.")
+		}()
+	}
+	wg.Wait()
+
+	if reg.IntGauge("ext."+name) == nil {
+		t.Error("int variable not imported")
+	}
+	if reg.IntGauge("ext."+taken) != nil {
+		t.Error("variable imported under the name of an existing counter")
+	}
+}
@@ -1,7 +1,11 @@
 package quant
 
 import (
-	"sync"
+	"maps"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
 )
 
 // GaugeReader represents a function that returns the gauge
@@ -12,9 +16,14 @@ type GaugeReader func() float64
 // by the underlying GaugeReader. Calling the gauge reader is
 // protected by a mutex. So it is safe to retrieve the gauge's
 // value concurrently.
+//
+// A panicking reader does not crash the application. Instead the
+// gauge reports NaN together with an error. The same applies to
+// readers which exceed an optional read timeout. Expensive readers
+// can be relieved by caching their results for a specified TTL.
 type Gauge struct {
 	metric
-	mtx    sync.Mutex
+	guard  readGuard[float64]
 	reader GaugeReader
 }
 
@@ -26,28 +35,347 @@ func newGauge(name, unit string, reader GaugeReader) *Gauge {
 }
 
 // Value returns the current value of tha underlying GaugeReader.
+// If the value cannot be read, NaN will be returned.
 func (g *Gauge) Value() float64 {
-	g.mtx.Lock()
-	val := g.reader()
-	g.mtx.Unlock()
+	val, _ := g.Read()
 	return val
 }
 
+// Read returns the current value of the underlying GaugeReader. If
+// the reader panics or exceeds the read timeout, NaN and an error
+// will be returned.
+func (g *Gauge) Read() (float64, error) {
+	val, err := g.guard.read(g.reader)
+	if err != nil {
+		return math.NaN(), err
+	}
+	return val, nil
+}
+
+// SetTimeout sets the maximum duration to wait for the reader. If the
+// timeout is not positive, Read waits until the reader returns. A reader
+// which exceeds the timeout is not called again until it returns.
+func (g *Gauge) SetTimeout(timeout time.Duration) {
+	g.guard.setTimeout(timeout)
+}
+
+// SetCacheTTL sets the duration a successfully read value is cached.
+// If the TTL is not positive, the reader is called on every read.
+func (g *Gauge) SetCacheTTL(ttl time.Duration) {
+	g.guard.setTTL(ttl)
+}
+
 func (g *Gauge) snapshot() *GaugeSnapshot {
-	return &GaugeSnapshot{
-		snapshot: snapshot{g.name, g.unit},
-		value:    g.Value(),
+	val, err := g.Read()
+	snap := newGaugeSnapshot(g.name, g.unit, val)
+	snap.err = err
+	return snap
+}
+
+// IntGaugeReader represents a function that returns the int64
+// gauge value whenever it is called.
+type IntGaugeReader func() int64
+
+// IntGauge represents an int64 metric which value is determined
+// by the underlying IntGaugeReader. In contrast to Gauge large
+// integral values are reported without rounding. Calling the gauge
+// reader is protected by a mutex. So it is safe to retrieve the
+// gauge's value concurrently. Panics, timeouts and caching are handled
+// the same way as for Gauge, except that failed reads result in zero.
+type IntGauge struct {
+	metric
+	guard  readGuard[int64]
+	reader IntGaugeReader
+}
+
+func newIntGauge(name, unit string, reader IntGaugeReader) *IntGauge {
+	return &IntGauge{
+		metric: metric{name, unit},
+		reader: reader,
 	}
 }
 
-// GaugeSnapshot represents a snapshot of a Gauge metric.
+// Value returns the current value of the underlying IntGaugeReader.
+// If the value cannot be read, zero will be returned.
+func (g *IntGauge) Value() int64 {
+	val, _ := g.Read()
+	return val
+}
+
+// Read returns the current value of the underlying IntGaugeReader. If
+// the reader panics or exceeds the read timeout, zero and an error will
+// be returned.
+func (g *IntGauge) Read() (int64, error) {
+	return g.guard.read(g.reader)
+}
+
+// SetTimeout sets the maximum duration to wait for the reader. If the
+// timeout is not positive, Read waits until the reader returns.
+func (g *IntGauge) SetTimeout(timeout time.Duration) {
+	g.guard.setTimeout(timeout)
+}
+
+// SetCacheTTL sets the duration a successfully read value is cached.
+// If the TTL is not positive, the reader is called on every read.
+func (g *IntGauge) SetCacheTTL(ttl time.Duration) {
+	g.guard.setTTL(ttl)
+}
+
+func (g *IntGauge) snapshot() *GaugeSnapshot {
+	val, err := g.Read()
+	snap := newIntGaugeSnapshot(g.name, g.unit, val)
+	snap.err = err
+	return snap
+}
+
+// GaugeSetReader represents a function that returns the values of
+// all gauges of a GaugeSet at once. The returned map is keyed by the
+// gauge names.
+type GaugeSetReader func() map[string]float64
+
+// GaugeSet represents a group of float64 metrics which values are
+// determined by a single call of the underlying GaugeSetReader. This
+// is useful if several related values are retrieved by an expensive
+// function. Gauges which are missing in the reader's result are reported
+// as NaN. Calling the reader is protected by a mutex. So it is safe to
+// retrieve the values concurrently. Panics, timeouts and caching are
+// handled the same way as for Gauge.
+type GaugeSet struct {
+	guard  readGuard[map[string]float64]
+	names  []string
+	units  map[string]string
+	reader GaugeSetReader
+}
+
+func newGaugeSet(units map[string]string, reader GaugeSetReader) *GaugeSet {
+	names := make([]string, 0, len(units))
+	copied := make(map[string]string, len(units))
+	for name, unit := range units {
+		names = append(names, name)
+		copied[name] = unit
+	}
+	sort.Strings(names)
+
+	return &GaugeSet{
+		names:  names,
+		units:  copied,
+		reader: reader,
+	}
+}
+
+// Names returns the names of all gauges in the set.
+func (s *GaugeSet) Names() []string {
+	return append([]string(nil), s.names...)
+}
+
+// Values returns the current values of the underlying GaugeSetReader.
+// If the values cannot be read, nil will be returned.
+func (s *GaugeSet) Values() map[string]float64 {
+	values, _ := s.Read()
+	return values
+}
+
+// Read returns the current values of the underlying GaugeSetReader.
+// If the reader panics or exceeds the read timeout, nil and an error
+// will be returned. The returned map is a copy, so it can be modified
+// without affecting cached values.
+func (s *GaugeSet) Read() (map[string]float64, error) {
+	values, err := s.guard.read(s.reader)
+	return maps.Clone(values), err
+}
+
+// SetTimeout sets the maximum duration to wait for the reader. If the
+// timeout is not positive, Read waits until the reader returns.
+func (s *GaugeSet) SetTimeout(timeout time.Duration) {
+	s.guard.setTimeout(timeout)
+}
+
+// SetCacheTTL sets the duration successfully read values are cached.
+// If the TTL is not positive, the reader is called on every read.
+func (s *GaugeSet) SetCacheTTL(ttl time.Duration) {
+	s.guard.setTTL(ttl)
+}
+
+func (s *GaugeSet) snapshots() []*GaugeSnapshot {
+	values, err := s.guard.read(s.reader)
+	snapshots := make([]*GaugeSnapshot, len(s.names))
+	for i, name := range s.names {
+		value, ok := values[name]
+		if !ok {
+			value = math.NaN()
+		}
+		snapshots[i] = newGaugeSnapshot(name, s.units[name], value)
+		snapshots[i].err = err
+	}
+	return snapshots
+}
+
+// SettableGauge represents a float64 metric which value is set
+// explicitly by the application instead of being read by a
+// GaugeReader. All operations are atomic, so it is safe to use
+// a settable gauge concurrently.
+type SettableGauge struct {
+	metric
+	bits uint64
+}
+
+func newSettableGauge(name, unit string) *SettableGauge {
+	return &SettableGauge{
+		metric: metric{name, unit},
+		bits:   math.Float64bits(0),
+	}
+}
+
+// Value returns the current value of the gauge.
+func (g *SettableGauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Set sets the value of the gauge.
+func (g *SettableGauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// Add adds the specified delta to the gauge and returns the
+// new value.
+func (g *SettableGauge) Add(delta float64) float64 {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		val := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(val)) {
+			return val
+		}
+	}
+}
+
+// Inc increases the gauge by one.
+func (g *SettableGauge) Inc() float64 {
+	return g.Add(1)
+}
+
+// Dec decreases the gauge by one.
+func (g *SettableGauge) Dec() float64 {
+	return g.Add(-1)
+}
+
+func (g *SettableGauge) snapshot() *GaugeSnapshot {
+	return newGaugeSnapshot(g.name, g.unit, g.Value())
+}
+
+// GaugeSnapshot represents a snapshot of a gauge metric.
 // This snapshot type is used during the reporting process.
 type GaugeSnapshot struct {
 	snapshot
-	value float64
+	value    float64
+	intValue int64
+	isInt    bool
+	err      error
+}
+
+func newGaugeSnapshot(name, unit string, value float64) *GaugeSnapshot {
+	return &GaugeSnapshot{
+		snapshot: snapshot{name, unit},
+		value:    value,
+		intValue: int64(value),
+		isInt:    false,
+	}
+}
+
+func newIntGaugeSnapshot(name, unit string, value int64) *GaugeSnapshot {
+	return &GaugeSnapshot{
+		snapshot: snapshot{name, unit},
+		value:    float64(value),
+		intValue: value,
+		isInt:    true,
+	}
+}
+
+// NewGaugeSnapshot creates a snapshot of a gauge with the given value.
+// It can be used to pass synthetic snapshots to a reporter.
+func NewGaugeSnapshot(name, unit string, value float64) *GaugeSnapshot {
+	return newGaugeSnapshot(name, unit, value)
+}
+
+// NewIntGaugeSnapshot creates a snapshot of an integer gauge with the
+// given value. It can be used to pass synthetic snapshots to a reporter.
+func NewIntGaugeSnapshot(name, unit string, value int64) *GaugeSnapshot {
+	return newIntGaugeSnapshot(name, unit, value)
+}
+
+// NewFailedGaugeSnapshot creates a snapshot of a gauge which could not
+// be read because of the given error.
+func NewFailedGaugeSnapshot(name, unit string, err error) *GaugeSnapshot {
+	snap := newGaugeSnapshot(name, unit, math.NaN())
+	snap.err = err
+	return snap
 }
 
 // Value returns the snapshot value of the underlying gauge.
 func (s *GaugeSnapshot) Value() float64 {
 	return s.value
 }
+
+// IntValue returns the snapshot value of the underlying gauge as
+// an int64. For float gauges the value is truncated towards zero.
+func (s *GaugeSnapshot) IntValue() int64 {
+	return s.intValue
+}
+
+// IsInt reports whether the underlying gauge is an IntGauge.
+// In this case IntValue should be used to retrieve the exact value.
+func (s *GaugeSnapshot) IsInt() bool {
+	return s.isInt
+}
+
+// Err returns the error which occurred while reading the gauge value,
+// e.g. a panic of the gauge reader or an exceeded read timeout. If the
+// value was read successfully nil will be returned.
+func (s *GaugeSnapshot) Err() error {
+	return s.err
+}
+
+func (s *GaugeSnapshot) withName(name string) *GaugeSnapshot {
+	snap := *s
+	snap.name = name
+	return &snap
+}
+
+// scaled returns a copy of the snapshot whose value is multiplied by the
+// given factor and which has the given unit.
+func (s *GaugeSnapshot) scaled(unit string, factor float64) *GaugeSnapshot {
+	snap := *s
+	snap.unit = unit
+	if snap.isInt && isIntFactor(factor) {
+		snap.intValue *= int64(factor)
+		snap.value = float64(snap.intValue)
+		return &snap
+	}
+
+	snap.isInt = false
+	snap.value *= factor
+	snap.intValue = int64(snap.value)
+	return &snap
+}
+
+// Merge adds the value of other to the snapshot, e.g. to combine the
+// number of in-flight requests of several processes. The result is an
+// integer gauge if both snapshots are. If one of the gauges could not be
+// read, the result carries its error. An error is returned if both
+// snapshots have different units.
+func (s *GaugeSnapshot) Merge(other *GaugeSnapshot) error {
+	if err := checkMergeUnits(&s.snapshot, &other.snapshot); err != nil {
+		return err
+	}
+
+	if s.err == nil {
+		s.err = other.err
+	}
+	s.isInt = s.isInt && other.isInt
+	s.value += other.value
+	if s.isInt {
+		s.intValue += other.intValue
+	} else {
+		s.intValue = int64(s.value)
+	}
+	return nil
+}
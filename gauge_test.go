@@ -1,7 +1,9 @@
 package quant
 
 import (
+	"math"
 	"testing"
+	"time"
 )
 
 func TestGauge(t *testing.T) {
@@ -14,3 +16,142 @@ func TestGauge(t *testing.T) {
 		t.Errorf("wrong gauge value: %f", g.Value())
 	}
 }
+
+func TestSettableGauge(t *testing.T) {
+	g := newSettableGauge("my-gauge", "")
+
+	g.Set(42)
+	g.Inc()
+	g.Dec()
+	g.Dec()
+	if v := g.Add(0.5); v != 41.5 {
+		t.Errorf("wrong gauge value: %f (41.5 expected)", v)
+	}
+	if g.Value() != 41.5 {
+		t.Errorf("wrong gauge value: %f (41.5 expected)", g.Value())
+	}
+	if snap := g.snapshot(); snap.Value() != 41.5 {
+		t.Errorf("wrong snapshot value: %f (41.5 expected)", snap.Value())
+	}
+}
+
+func TestIntGauge(t *testing.T) {
+	const value = 1<<62 + 1
+	g := newIntGauge("my-gauge", "", func() int64 { return value })
+
+	if g.Value() != value {
+		t.Errorf("wrong gauge value: %d (%d expected)", g.Value(), int64(value))
+	}
+
+	snap := g.snapshot()
+	if !snap.IsInt() {
+		t.Error("int gauge snapshot is not an int snapshot")
+	}
+	if snap.IntValue() != value {
+		t.Errorf("wrong snapshot value: %d (%d expected)", snap.IntValue(), int64(value))
+	}
+}
+
+func TestGaugeSet(t *testing.T) {
+	calls := 0
+	s := newGaugeSet(map[string]string{"a": "MB", "b": "", "c": ""}, func() map[string]float64 {
+		calls++
+		return map[string]float64{"a": 1, "b": 2}
+	})
+
+	snaps := s.snapshots()
+	if calls != 1 {
+		t.Errorf("wrong number of reader calls: %d (1 expected)", calls)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("wrong number of snapshots: %d (3 expected)", len(snaps))
+	}
+	if snaps[0].Name() != "a" || snaps[0].Unit() != "MB" || snaps[0].Value() != 1 {
+		t.Errorf("wrong snapshot: %s=%f%s (a=1MB expected)", snaps[0].Name(), snaps[0].Value(), snaps[0].Unit())
+	}
+	if snaps[1].Name() != "b" || snaps[1].Value() != 2 {
+		t.Errorf("wrong snapshot: %s=%f (b=2 expected)", snaps[1].Name(), snaps[1].Value())
+	}
+	if snaps[2].Name() != "c" || !math.IsNaN(snaps[2].Value()) {
+		t.Errorf("wrong snapshot: %s=%f (c=NaN expected)", snaps[2].Name(), snaps[2].Value())
+	}
+}
+
+func TestGaugePanic(t *testing.T) {
+	g := newGauge("my-gauge", "", func() float64 { panic("boom") })
+
+	snap := g.snapshot()
+	if !math.IsNaN(snap.Value()) {
+		t.Errorf("wrong gauge value: %f (NaN expected)", snap.Value())
+	}
+	if snap.Err() == nil {
+		t.Error("no error for panicking gauge reader")
+	}
+}
+
+func TestGaugeTimeout(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	g := newGauge("my-gauge", "", func() float64 {
+		calls++
+		<-release
+		return 7
+	})
+	g.SetTimeout(10 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if val, err := g.Read(); err != ErrReadTimeout || !math.IsNaN(val) {
+			t.Errorf("wrong gauge result: %f, %v (NaN, %v expected)", val, err, ErrReadTimeout)
+		}
+	}
+
+	close(release)
+	if val, err := g.Read(); err != nil || val != 7 {
+		t.Errorf("wrong gauge result: %f, %v (7, nil expected)", val, err)
+	}
+	if calls > 2 {
+		t.Errorf("wrong number of reader calls: %d (at most 2 expected)", calls)
+	}
+}
+
+func TestGaugeCache(t *testing.T) {
+	calls := 0
+	g := newGauge("my-gauge", "", func() float64 {
+		calls++
+		return float64(calls)
+	})
+	g.SetCacheTTL(time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if g.Value() != 1 {
+			t.Errorf("wrong gauge value: %f (1 expected)", g.Value())
+		}
+	}
+
+	g.SetCacheTTL(0)
+	if g.Value() != 2 {
+		t.Errorf("wrong gauge value: %f (2 expected)", g.Value())
+	}
+}
+
+func TestGaugeSetCachedValuesCopy(t *testing.T) {
+	s := newGaugeSet(map[string]string{"a": ""}, func() map[string]float64 {
+		return map[string]float64{"a": 1}
+	})
+	s.SetCacheTTL(time.Hour)
+
+	values := s.Values()
+	values["a"] = 2
+	if values = s.Values(); values["a"] != 1 {
+		t.Errorf("cached value modified by the caller: %f (1 expected)", values["a"])
+	}
+}
+
+func TestGaugeSetPanic(t *testing.T) {
+	s := newGaugeSet(map[string]string{"a": ""}, func() map[string]float64 { panic("boom") })
+
+	snaps := s.snapshots()
+	if !math.IsNaN(snaps[0].Value()) || snaps[0].Err() == nil {
+		t.Errorf("wrong snapshot for panicking reader: %f, %v", snaps[0].Value(), snaps[0].Err())
+	}
+}
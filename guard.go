@@ -0,0 +1,109 @@
+package quant
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrReadTimeout is reported by gauges which reader did not return
+// within the configured read timeout.
+var ErrReadTimeout = errors.New("gauge read timeout")
+
+// readGuard protects the calls of a gauge reader. It makes sure that
+// the reader is not called concurrently, recovers from panics, limits
+// the time a caller waits for the result and caches the results for
+// a configurable amount of time.
+type readGuard[T any] struct {
+	mtx      sync.Mutex
+	timeout  time.Duration
+	ttl      time.Duration
+	cached   T
+	cachedAt time.Time
+	inflight *readCall[T]
+}
+
+// readCall represents a single call of a gauge reader. The done
+// channel is closed as soon as the reader returns.
+type readCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+func (g *readGuard[T]) setTimeout(timeout time.Duration) {
+	g.mtx.Lock()
+	g.timeout = timeout
+	g.mtx.Unlock()
+}
+
+func (g *readGuard[T]) setTTL(ttl time.Duration) {
+	g.mtx.Lock()
+	g.ttl = ttl
+	g.cachedAt = time.Time{}
+	g.mtx.Unlock()
+}
+
+// read returns the result of reader. If a cached value is still valid,
+// it is returned without calling the reader. If another call of reader is
+// already in progress, its result is awaited instead of calling the reader
+// again. If the reader panics or does not return within the timeout,
+// the zero value of T will be returned together with an error.
+func (g *readGuard[T]) read(reader func() T) (T, error) {
+	g.mtx.Lock()
+	if g.ttl > 0 && !g.cachedAt.IsZero() && time.Since(g.cachedAt) < g.ttl {
+		val := g.cached
+		g.mtx.Unlock()
+		return val, nil
+	}
+
+	timeout := g.timeout
+	call := g.inflight
+	if call == nil {
+		call = &readCall[T]{done: make(chan struct{})}
+		g.inflight = call
+		g.mtx.Unlock()
+		if timeout <= 0 {
+			g.call(call, reader)
+			return call.val, call.err
+		}
+		go g.call(call, reader)
+	} else {
+		g.mtx.Unlock()
+	}
+
+	if timeout <= 0 {
+		<-call.done
+		return call.val, call.err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-timer.C:
+		var zero T
+		return zero, ErrReadTimeout
+	}
+}
+
+func (g *readGuard[T]) call(call *readCall[T], reader func() T) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("gauge reader panic: %v", r)
+		}
+
+		g.mtx.Lock()
+		if call.err == nil {
+			g.cached = call.val
+			g.cachedAt = time.Now()
+		}
+		g.inflight = nil
+		g.mtx.Unlock()
+		close(call.done)
+	}()
+
+	call.val = reader()
+}
@@ -0,0 +1,360 @@
+package quant
+
+import (
+	"math"
+	"math/bits"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hdrLayout describes the buckets of an HDR histogram (Gil Tene's
+// HdrHistogram) for integer values between 0 and highest. Each power of
+// two range is split into sub-buckets of equal size, so that the value
+// ranges of the buckets keep the given number of significant decimal
+// digits.
+type hdrLayout struct {
+	highest                     int64
+	digits                      int
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount          int
+	subBucketMask               int64
+	leadingZeroCountBase        int
+	countsLen                   int
+}
+
+func newHDRLayout(highest int64, digits int) *hdrLayout {
+	largestSingleUnit := 2 * int64(math.Pow10(digits))
+	subBucketCountMagnitude := int(math.Ceil(math.Log2(float64(largestSingleUnit))))
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	bucketCount := 1
+	for smallestUntrackable := subBucketCount; smallestUntrackable <= highest; smallestUntrackable <<= 1 {
+		bucketCount++
+		if smallestUntrackable > math.MaxInt64/2 {
+			break
+		}
+	}
+
+	l := &hdrLayout{
+		highest:                     highest,
+		digits:                      digits,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount:          int(subBucketCount / 2),
+		subBucketMask:               subBucketCount - 1,
+		leadingZeroCountBase:        64 - subBucketCountMagnitude,
+	}
+	l.countsLen = (bucketCount + 1) * l.subBucketHalfCount
+	return l
+}
+
+func (l *hdrLayout) equals(other *hdrLayout) bool {
+	return l.highest == other.highest && l.digits == other.digits
+}
+
+// index returns the index of the bucket which counts the given value.
+// Values outside the trackable range are clamped.
+func (l *hdrLayout) index(v int64) int {
+	switch {
+	case v < 0:
+		v = 0
+	case v > l.highest:
+		v = l.highest
+	}
+	bucketIdx := l.leadingZeroCountBase - bits.LeadingZeros64(uint64(v|l.subBucketMask))
+	subBucketIdx := int(v >> uint(bucketIdx))
+	return (bucketIdx+1)<<uint(l.subBucketHalfCountMagnitude) + subBucketIdx - l.subBucketHalfCount
+}
+
+// bounds returns the lowest and the highest value which are counted in
+// the bucket with the given index.
+func (l *hdrLayout) bounds(idx int) (int64, int64) {
+	bucketIdx := idx>>uint(l.subBucketHalfCountMagnitude) - 1
+	subBucketIdx := idx&(l.subBucketHalfCount-1) + l.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= l.subBucketHalfCount
+		bucketIdx = 0
+	}
+	lowest := int64(subBucketIdx) << uint(bucketIdx)
+	return lowest, lowest + int64(1)<<uint(bucketIdx) - 1
+}
+
+// hdrHistogram holds the non-empty buckets of an HDR histogram sorted by
+// their indexes. The bucket values are integers, which are divided by
+// scale to get the values in the unit of the metric.
+type hdrHistogram struct {
+	layout  *hdrLayout
+	scale   float64
+	indexes []int
+	counts  []uint64
+}
+
+func (h *hdrHistogram) clone() *hdrHistogram {
+	c := *h
+	c.indexes = append([]int(nil), h.indexes...)
+	c.counts = append([]uint64(nil), h.counts...)
+	return &c
+}
+
+func (h *hdrHistogram) count() uint64 {
+	var n uint64
+	for _, c := range h.counts {
+		n += c
+	}
+	return n
+}
+
+// each calls fn for each non-empty bucket with the median value of the
+// bucket in the unit of the metric.
+func (h *hdrHistogram) each(fn func(v float64, n uint64)) {
+	for i, idx := range h.indexes {
+		lowest, highest := h.layout.bounds(idx)
+		fn(float64(lowest+(highest-lowest+1)/2)/h.scale, h.counts[i])
+	}
+}
+
+// add adds n occurrences of a value in the unit of the metric.
+func (h *hdrHistogram) add(v float64, n uint64) {
+	if math.IsNaN(v) {
+		return
+	}
+	idx := h.layout.index(int64(math.Min(math.Round(v*h.scale), math.MaxInt64)))
+	i := sort.SearchInts(h.indexes, idx)
+	if i < len(h.indexes) && h.indexes[i] == idx {
+		h.counts[i] += n
+		return
+	}
+	h.indexes = append(h.indexes, 0)
+	h.counts = append(h.counts, 0)
+	copy(h.indexes[i+1:], h.indexes[i:])
+	copy(h.counts[i+1:], h.counts[i:])
+	h.indexes[i], h.counts[i] = idx, n
+}
+
+// merge adds all values of other to the histogram. If both histograms
+// have the same layout and scale, the bucket counts are added exactly.
+func (h *hdrHistogram) merge(other *hdrHistogram) {
+	if !h.layout.equals(other.layout) || h.scale != other.scale {
+		other.each(h.add)
+		return
+	}
+
+	indexes := make([]int, 0, len(h.indexes)+len(other.indexes))
+	counts := make([]uint64, 0, len(h.counts)+len(other.counts))
+	i, j := 0, 0
+	for i < len(h.indexes) || j < len(other.indexes) {
+		switch {
+		case j == len(other.indexes) || (i < len(h.indexes) && h.indexes[i] < other.indexes[j]):
+			indexes, counts = append(indexes, h.indexes[i]), append(counts, h.counts[i])
+			i++
+		case i == len(h.indexes) || other.indexes[j] < h.indexes[i]:
+			indexes, counts = append(indexes, other.indexes[j]), append(counts, other.counts[j])
+			j++
+		default:
+			indexes, counts = append(indexes, h.indexes[i]), append(counts, h.counts[i]+other.counts[j])
+			i++
+			j++
+		}
+	}
+	h.indexes, h.counts = indexes, counts
+}
+
+// quantile returns the highest value which is equivalent to the value
+// at the q-quantile (0 <= q <= 1), in the unit of the metric.
+func (h *hdrHistogram) quantile(q float64) float64 {
+	n := h.count()
+	if n == 0 {
+		return math.NaN()
+	}
+
+	rank := uint64(math.Ceil(q * float64(n)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cum uint64
+	for i, c := range h.counts {
+		if cum += c; cum >= rank {
+			_, highest := h.layout.bounds(h.indexes[i])
+			return float64(highest) / h.scale
+		}
+	}
+	_, highest := h.layout.bounds(h.indexes[len(h.indexes)-1])
+	return float64(highest) / h.scale
+}
+
+// buckets returns the non-empty buckets with their upper bounds in the
+// unit of the metric.
+func (h *hdrHistogram) buckets() []Bucket {
+	res := make([]Bucket, len(h.indexes))
+	for i, idx := range h.indexes {
+		_, highest := h.layout.bounds(idx)
+		res[i] = Bucket{UpperBound: float64(highest) / h.scale, Count: h.counts[i]}
+	}
+	return res
+}
+
+// hdrRecorder records durations into an HDR histogram without locks.
+// The recorded values are kept in an interval, which is swapped with a
+// fresh one on each snapshot. A writer-reader phaser guarantees that
+// all writers which started recording into the swapped interval have
+// finished before the snapshot is taken.
+type hdrRecorder struct {
+	layout   *hdrLayout
+	phaser   phaser
+	active   atomic.Pointer[hdrInterval]
+	mtx      sync.Mutex // serializes snapshots
+	inactive *hdrInterval
+}
+
+// hdrInterval holds the values recorded since the previous snapshot.
+// The sums are computed over the differences to the first recorded
+// value (shift), so that the variance does not suffer from catastrophic
+// cancellation for large, tightly clustered durations.
+type hdrInterval struct {
+	counts       []atomic.Uint64
+	min          atomic.Int64
+	max          atomic.Int64
+	shift        atomic.Int64
+	shiftedSum   atomic.Int64
+	shiftedSumSq atomic.Uint64 // float64 bits
+	exemplar     atomic.Pointer[Exemplar]
+}
+
+func newHDRRecorder(highest time.Duration, digits int) *hdrRecorder {
+	r := &hdrRecorder{layout: newHDRLayout(int64(highest), digits)}
+	r.phaser.init()
+	r.active.Store(r.newInterval())
+	r.inactive = r.newInterval()
+	return r
+}
+
+func (r *hdrRecorder) newInterval() *hdrInterval {
+	iv := &hdrInterval{counts: make([]atomic.Uint64, r.layout.countsLen)}
+	iv.reset()
+	return iv
+}
+
+func (iv *hdrInterval) reset() {
+	for i := range iv.counts {
+		iv.counts[i].Store(0)
+	}
+	iv.min.Store(math.MaxInt64)
+	iv.max.Store(math.MinInt64)
+	iv.shift.Store(math.MinInt64)
+	iv.shiftedSum.Store(0)
+	iv.shiftedSumSq.Store(0)
+	iv.exemplar.Store(nil)
+}
+
+func (r *hdrRecorder) record(d time.Duration, exemplar *Exemplar) {
+	v := int64(d)
+	switch {
+	case v < 0:
+		v = 0
+	case v > r.layout.highest:
+		v = r.layout.highest
+	}
+
+	phase := r.phaser.enter()
+	iv := r.active.Load()
+	iv.counts[r.layout.index(v)].Add(1)
+	for cur := iv.min.Load(); v < cur && !iv.min.CompareAndSwap(cur, v); cur = iv.min.Load() {
+	}
+	for cur := iv.max.Load(); v > cur && !iv.max.CompareAndSwap(cur, v); cur = iv.max.Load() {
+	}
+	iv.shift.CompareAndSwap(math.MinInt64, v)
+	dv := v - iv.shift.Load()
+	iv.shiftedSum.Add(dv)
+	for {
+		cur := iv.shiftedSumSq.Load()
+		if iv.shiftedSumSq.CompareAndSwap(cur, math.Float64bits(math.Float64frombits(cur)+float64(dv)*float64(dv))) {
+			break
+		}
+	}
+	if exemplar != nil {
+		iv.exemplar.Store(exemplar)
+	}
+	r.phaser.exit(phase)
+}
+
+// snapshot swaps the active interval and returns a snapshot of the
+// values recorded since the previous snapshot, in the given time unit.
+func (r *hdrRecorder) snapshot(name string, unit TimeUnit) *TimerSnapshot {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.inactive.reset()
+	iv := r.active.Swap(r.inactive)
+	r.phaser.flip()
+	r.inactive = iv
+
+	scale := float64(unit)
+	snap := newTimerSnaphot(name, unit.String())
+	snap.hdr = &hdrHistogram{layout: r.layout, scale: scale}
+	for idx := range iv.counts {
+		if n := iv.counts[idx].Load(); n != 0 {
+			snap.hdr.indexes = append(snap.hdr.indexes, idx)
+			snap.hdr.counts = append(snap.hdr.counts, n)
+			snap.count += int(n)
+		}
+	}
+	if snap.count != 0 {
+		snap.min = float64(iv.min.Load()) / scale
+		snap.max = float64(iv.max.Load()) / scale
+		n, shift := float64(snap.count), float64(iv.shift.Load())
+		s1, s2 := float64(iv.shiftedSum.Load()), math.Float64frombits(iv.shiftedSumSq.Load())
+		snap.sum = (shift*n + s1) / scale
+		snap.mean = (shift + s1/n) / scale
+		snap.m2 = math.Max(s2-s1*s1/n, 0) / (scale * scale)
+	}
+	snap.exemplar = iv.exemplar.Load()
+	return snap
+}
+
+// phaser is a writer-reader phaser. Writers enter and exit a critical
+// section without blocking each other. A reader which flips the phase
+// waits until all writers which entered the critical section before
+// the flip have exited it. Readers must be serialized by the caller.
+type phaser struct {
+	start   atomic.Int64
+	evenEnd atomic.Int64
+	oddEnd  atomic.Int64
+}
+
+func (p *phaser) init() {
+	p.oddEnd.Store(math.MinInt64)
+}
+
+func (p *phaser) enter() int64 {
+	return p.start.Add(1) - 1
+}
+
+func (p *phaser) exit(phase int64) {
+	if phase < 0 {
+		p.oddEnd.Add(1)
+	} else {
+		p.evenEnd.Add(1)
+	}
+}
+
+func (p *phaser) flip() {
+	nextIsEven := p.start.Load() < 0
+	var initial int64
+	if nextIsEven {
+		p.evenEnd.Store(initial)
+	} else {
+		initial = math.MinInt64
+		p.oddEnd.Store(initial)
+	}
+
+	startAtFlip := p.start.Swap(initial)
+	end := &p.evenEnd
+	if nextIsEven {
+		end = &p.oddEnd
+	}
+	for end.Load() != startAtFlip {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,155 @@
+package quant
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHDRLayout(t *testing.T) {
+	l := newHDRLayout(int64(time.Hour), 3)
+	for _, v := range []int64{0, 1, 1023, 2047, 2048, 4095, 123456, 999999999, int64(time.Hour)} {
+		idx := l.index(v)
+		if idx < 0 || idx >= l.countsLen {
+			t.Fatalf("index out of range for %d: %d", v, idx)
+		}
+		lowest, highest := l.bounds(idx)
+		if v < lowest || v > highest {
+			t.Errorf("wrong bounds for %d: [%d, %d]", v, lowest, highest)
+		}
+		if float64(highest-lowest) > 1e-3*float64(v) && highest != lowest {
+			t.Errorf("bucket of %d too wide: [%d, %d]", v, lowest, highest)
+		}
+	}
+	if idx := l.index(int64(2 * time.Hour)); idx != l.index(int64(time.Hour)) {
+		t.Errorf("values above the highest trackable value not clamped: %d", idx)
+	}
+}
+
+func TestHDRTimer(t *testing.T) {
+	reg := NewRegistry("reg")
+	timer := reg.NewHDRTimer("latency", Milliseconds, time.Minute, 3)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 1000; i++ {
+				timer.Update(time.Duration(i) * time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+	timer.Start().RecordWithExemplar("abc")
+
+	snap := timer.snapshot()
+	switch {
+	case snap.Count() != 4001:
+		t.Errorf("wrong count: %d (4001 expected)", snap.Count())
+	case snap.Maximum() != 1000:
+		t.Errorf("wrong maximum: %v (1000 expected)", snap.Maximum())
+	case snap.Exemplar() == nil || snap.Exemplar().TraceID != "abc":
+		t.Errorf("wrong exemplar: %+v", snap.Exemplar())
+	case math.Abs(snap.Average()-4*500500/4001.0) > 1e-6:
+		t.Errorf("wrong average: %v", snap.Average())
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		expected := math.Ceil(q * 1000)
+		if res := snap.Quantile(q); math.Abs(res-expected) > 1e-3*expected {
+			t.Errorf("wrong %v-quantile: %v (%v expected)", q, res, expected)
+		}
+	}
+
+	var total uint64
+	prev := math.Inf(-1)
+	for _, b := range snap.Buckets() {
+		if b.UpperBound <= prev {
+			t.Errorf("buckets not sorted: %v after %v", b.UpperBound, prev)
+		}
+		prev = b.UpperBound
+		total += b.Count
+	}
+	if total != 4001 {
+		t.Errorf("wrong bucket counts: %d (4001 expected)", total)
+	}
+
+	if next := timer.snapshot(); next.Count() != 0 || len(next.Buckets()) != 0 {
+		t.Errorf("timer not reset after snapshot: %d", next.Count())
+	}
+}
+
+func TestHDRTimerConcurrentSnapshots(t *testing.T) {
+	timer := newHDRTimer("latency", Microseconds, time.Second, 2)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				timer.Update(time.Microsecond)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	total := 0
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		total += timer.snapshot().Count()
+	}
+	total += timer.snapshot().Count()
+	if total != 40000 {
+		t.Errorf("lost measurements: %d (40000 expected)", total)
+	}
+}
+
+func TestHDRSnapshotMergeAndEncoding(t *testing.T) {
+	t1 := newHDRTimer("latency", Milliseconds, time.Minute, 3)
+	t2 := newHDRTimer("latency", Milliseconds, time.Minute, 3)
+	for i := 1; i <= 100; i++ {
+		t1.Update(time.Duration(i) * time.Millisecond)
+		t2.Update(time.Duration(100+i) * time.Millisecond)
+	}
+	s1, s2 := t1.snapshot(), t2.snapshot()
+	if err := s1.Merge(s2); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	if s1.Count() != 200 || math.Abs(s1.Quantile(0.5)-100) > 0.1 {
+		t.Errorf("wrong merged snapshot: count=%d, median=%v", s1.Count(), s1.Quantile(0.5))
+	}
+
+	data, _ := s1.MarshalBinary()
+	var decoded TimerSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if len(decoded.Buckets()) != len(s1.Buckets()) || decoded.Quantile(0.9) != s1.Quantile(0.9) {
+		t.Errorf("wrong decoded snapshot: %v", decoded.Buckets())
+	}
+
+	data, _ = json.Marshal(s1)
+	decoded = TimerSnapshot{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if decoded.Quantile(0.9) != s1.Quantile(0.9) {
+		t.Errorf("wrong decoded 0.9-quantile: %v (%v expected)", decoded.Quantile(0.9), s1.Quantile(0.9))
+	}
+
+	converted := s1.scaled("s", 0.001)
+	if q := converted.Quantile(0.5); math.Abs(q-0.1) > 1e-4 {
+		t.Errorf("wrong converted median: %v (0.1 expected)", q)
+	}
+}
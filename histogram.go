@@ -0,0 +1,121 @@
+package quant
+
+import (
+	"sync"
+)
+
+// Histogram represents a metric which tracks the distribution of
+// a series of float64 values, e.g. response sizes. In contrast to
+// Timer the values are not durations but arbitrary quantities. It
+// is safe to use a histogram concurrently.
+type Histogram struct {
+	metric
+	accuracy float64   // relative accuracy of the quantile sketch
+	bounds   []float64 // upper bounds of explicit buckets
+	mtx      sync.Mutex
+	snap     *HistogramSnapshot
+}
+
+func newHistogram(name, unit string) *Histogram {
+	return newSketchHistogram(name, unit, 0)
+}
+
+// newSketchHistogram creates a histogram which estimates quantiles with
+// a sketch of the given relative accuracy. If the accuracy is zero, a
+// uniform sample is used instead.
+func newSketchHistogram(name, unit string, accuracy float64) *Histogram {
+	h := &Histogram{
+		metric:   metric{name, unit},
+		accuracy: accuracy,
+	}
+	h.snap = h.newSnapshot()
+	return h
+}
+
+// newBucketedHistogram creates a histogram which additionally counts
+// its values in buckets with the given upper bounds.
+func newBucketedHistogram(name, unit string, bounds []float64) *Histogram {
+	h := &Histogram{
+		metric: metric{name, unit},
+		bounds: bounds,
+	}
+	h.snap = h.newSnapshot()
+	return h
+}
+
+func (h *Histogram) newSnapshot() *HistogramSnapshot {
+	snap := newHistogramSnapshot(h.name, h.unit)
+	if h.accuracy > 0 {
+		snap.sketch = newDDSketch(h.accuracy)
+	}
+	if h.bounds != nil {
+		snap.buckets = newBucketCounts(h.bounds)
+	}
+	return snap
+}
+
+// Observe adds a value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.mtx.Lock()
+	h.snap.add(value)
+	h.mtx.Unlock()
+}
+
+func (h *Histogram) snapshot() *HistogramSnapshot {
+	h.mtx.Lock()
+	snap := h.snap
+	h.snap = h.newSnapshot()
+	h.mtx.Unlock()
+	snap.sortSample()
+	return snap
+}
+
+// HistogramSnapshot represents a snapshot of a Histogram metric.
+// This snapshot type is used during the reporting process.
+// If the snapshot is empty, all its statistics including the
+// quantiles are zero.
+type HistogramSnapshot struct {
+	reservoirSnapshot
+}
+
+func newHistogramSnapshot(name, unit string) *HistogramSnapshot {
+	return &HistogramSnapshot{
+		reservoirSnapshot: *newReservoirSnaphot(name, unit),
+	}
+}
+
+// NewHistogramSnapshot creates a snapshot of a histogram which contains
+// the given values. It can be used to pass synthetic snapshots to a
+// reporter.
+func NewHistogramSnapshot(name, unit string, values ...float64) *HistogramSnapshot {
+	snap := newHistogramSnapshot(name, unit)
+	for _, v := range values {
+		snap.add(v)
+	}
+	snap.sortSample()
+	return snap
+}
+
+// Merge adds all values of other to the snapshot, e.g. to combine the
+// histograms of several processes. Count, sum, minimum and maximum are
+// merged exactly, the quantile estimations are based on a uniform sample
+// of the values of both snapshots. An error is returned if both snapshots
+// have different units or if both contain values counted in buckets with
+// different bounds. In this case the snapshot is not changed.
+func (s *HistogramSnapshot) Merge(other *HistogramSnapshot) error {
+	if err := checkMergeUnits(&s.snapshot, &other.snapshot); err != nil {
+		return err
+	}
+	if err := checkMergeBuckets(&s.reservoirSnapshot, &other.reservoirSnapshot); err != nil {
+		return err
+	}
+
+	s.merge(&other.reservoirSnapshot)
+	return nil
+}
+
+func (s *HistogramSnapshot) withName(name string) *HistogramSnapshot {
+	snap := *s
+	snap.name = name
+	return &snap
+}
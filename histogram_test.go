@@ -0,0 +1,23 @@
+package quant
+
+import (
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram("my-histogram", "B")
+
+	if h.Name() != "my-histogram" {
+		t.Errorf("wrong histogram name: %s", h.Name())
+	}
+
+	h.Observe(1)
+	h.Observe(3)
+	snap := h.snapshot()
+	if snap.Count() != 2 || snap.Average() != 2 {
+		t.Errorf("wrong histogram snapshot: count=%d, avg=%f (2/2 expected)", snap.Count(), snap.Average())
+	}
+	if snap := h.snapshot(); snap.Count() != 0 {
+		t.Errorf("histogram snapshot was not reset: count=%d", snap.Count())
+	}
+}
@@ -0,0 +1,250 @@
+package quant
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Names of the metrics recorded by HTTPMiddleware. The request timers
+// are named HTTPServerRequests.<route>.<method>.<status class>, e.g.
+// "http.server.requests./users/{id}.GET.2xx". Methods other than the
+// standard HTTP methods are named "other".
+const (
+	HTTPServerRequests     = "http.server.requests"
+	HTTPServerInFlight     = "http.server.in_flight"
+	HTTPServerResponseSize = "http.server.response_size"
+)
+
+// RouteNamer represents a function that maps a request to the name of
+// its route. The route name becomes part of the metric names, so it
+// should not contain variable parts of the URL path like IDs. The namer
+// is called after the request was handled.
+type RouteNamer func(r *http.Request) string
+
+// PatternRouteNamer is a RouteNamer which uses the pattern of the
+// http.ServeMux route that matched the request (without the method).
+// Requests which were not matched by a pattern are named "unmatched".
+// The pattern is only available since Go 1.23, older versions name all
+// requests "unmatched".
+func PatternRouteNamer(r *http.Request) string {
+	pattern := requestPattern(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	// strip the method and host from patterns like "GET example.com/users/{id}"
+	if idx := strings.IndexAny(pattern, " \t"); idx >= 0 {
+		pattern = strings.TrimLeft(pattern[idx:], " \t")
+	}
+	if idx := strings.IndexByte(pattern, '/'); idx > 0 {
+		pattern = pattern[idx:]
+	}
+	return pattern
+}
+
+// PathRouteNamer is a RouteNamer which uses the URL path of the request.
+// The number of routes is not bounded, so each path a client requests
+// creates new timers in the registry. It should only be used if the
+// handler rejects unknown paths before they reach the middleware, or
+// if the set of paths is known to be small for other reasons.
+func PathRouteNamer(r *http.Request) string {
+	return r.URL.Path
+}
+
+// HTTPMiddleware wraps the given handler to record request metrics
+// into the registry. The routes are named by PatternRouteNamer.
+// See HTTPMiddlewareWithRoutes for details.
+func HTTPMiddleware(registry *Registry, next http.Handler) http.Handler {
+	return HTTPMiddlewareWithRoutes(registry, next, PatternRouteNamer)
+}
+
+// HTTPMiddlewareWithRoutes wraps the given handler to record request
+// metrics into the registry. For each combination of route, method and
+// status class (1xx to 5xx) a timer is created on demand. Additionally
+// the number of requests in flight is counted and the response sizes
+// are recorded in a histogram. If a timer name is already used by
+// another metric type, the duration of the request is not recorded.
+func HTTPMiddlewareWithRoutes(registry *Registry, next http.Handler, route RouteNamer) http.Handler {
+	return &httpMiddleware{
+		registry: registry,
+		next:     next,
+		route:    route,
+		inFlight: registry.counterOrNew(HTTPServerInFlight),
+		sizes:    registry.histogramOrNew(HTTPServerResponseSize, "B"),
+	}
+}
+
+type httpMiddleware struct {
+	registry *Registry
+	next     http.Handler
+	route    RouteNamer
+	inFlight *Counter
+	sizes    *Histogram
+}
+
+func (m *httpMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the timer is only known after the request was handled
+	sw := newStopwatch(nil)
+	m.inFlight.Increment()
+	defer m.inFlight.Decrement()
+
+	rw := &responseRecorder{ResponseWriter: w}
+	m.next.ServeHTTP(rw.withOptionalInterfaces(), r)
+
+	name := HTTPServerRequests + "." + m.route(r) + "." + httpMethod(r.Method) + "." + statusClass(rw.status())
+	if sw.timer = m.registry.timerOrNewIfFree(name, Milliseconds); sw.timer != nil {
+		sw.Record()
+	}
+	m.sizes.Observe(float64(rw.written))
+}
+
+// httpMethod returns the given method if it is one of the standard
+// HTTP methods and "other" otherwise. This bounds the number of timers
+// clients can create with arbitrary methods.
+func httpMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// responseRecorder wraps a http.ResponseWriter to record the status
+// code and the number of written bytes.
+type responseRecorder struct {
+	http.ResponseWriter
+	code    int
+	written int64
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom. If the underlying writer supports
+// it, the data is passed on to benefit from its optimizations, e.g.
+// sendfile.
+func (w *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		w.written += n
+		return n, err
+	}
+	return io.Copy(writerOnly{w}, src)
+}
+
+// writerOnly hides the ReadFrom method of a writer, so io.Copy does not
+// call it recursively.
+type writerOnly struct {
+	io.Writer
+}
+
+// Unwrap returns the underlying writer. It is used by http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseRecorder) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// withOptionalInterfaces returns the recorder wrapped into a type which
+// implements http.Flusher and http.Hijacker only if the underlying writer
+// does, so that handlers can still detect whether streaming or hijacking
+// is supported.
+func (w *responseRecorder) withOptionalInterfaces() http.ResponseWriter {
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return &flushHijackRecorder{w}
+	case flusher:
+		return &flushRecorder{w}
+	case hijacker:
+		return &hijackRecorder{w}
+	}
+	return w
+}
+
+func (w *responseRecorder) flush() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijack hijacks the connection of the underlying writer. Hijacked
+// requests without a status code, e.g. WebSocket upgrades, are recorded
+// with the status code 101.
+func (w *responseRecorder) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// flushRecorder is a responseRecorder which implements http.Flusher.
+type flushRecorder struct {
+	*responseRecorder
+}
+
+// Flush implements http.Flusher.
+func (w *flushRecorder) Flush() {
+	w.flush()
+}
+
+// hijackRecorder is a responseRecorder which implements http.Hijacker.
+type hijackRecorder struct {
+	*responseRecorder
+}
+
+// Hijack implements http.Hijacker.
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// flushHijackRecorder is a responseRecorder which implements both
+// http.Flusher and http.Hijacker.
+type flushHijackRecorder struct {
+	*responseRecorder
+}
+
+// Flush implements http.Flusher.
+func (w *flushHijackRecorder) Flush() {
+	w.flush()
+}
+
+// Hijack implements http.Hijacker.
+func (w *flushHijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
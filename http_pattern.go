@@ -0,0 +1,11 @@
+//go:build go1.23
+
+package quant
+
+import "net/http"
+
+// requestPattern returns the pattern of the http.ServeMux route that
+// matched the request.
+func requestPattern(r *http.Request) string {
+	return r.Pattern
+}
@@ -0,0 +1,11 @@
+//go:build !go1.23
+
+package quant
+
+import "net/http"
+
+// requestPattern returns an empty pattern, since http.Request does not
+// provide the matched pattern before Go 1.23.
+func requestPattern(r *http.Request) string {
+	return ""
+}
@@ -0,0 +1,66 @@
+//go:build go1.23
+
+//go:debug httpmuxgo121=0
+
+package quant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	reg := NewRegistry("reg")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if reg.Counter(HTTPServerInFlight).Value() != 1 {
+			t.Errorf("wrong number of requests in flight: %d (1 expected)", reg.Counter(HTTPServerInFlight).Value())
+		}
+		w.Write([]byte("hello"))
+	})
+	handler := HTTPMiddleware(reg, mux)
+
+	for _, path := range []string{"/users/1", "/users/2", "/unknown"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	ok := reg.Timer("http.server.requests./users/{id}.GET.2xx")
+	if ok == nil {
+		t.Fatal("no timer for successful requests")
+	}
+	if snap := ok.snapshot(); snap.Count() != 2 {
+		t.Errorf("wrong number of successful requests: %d (2 expected)", snap.Count())
+	}
+	if reg.Timer("http.server.requests.unmatched.GET.4xx") == nil {
+		t.Error("no timer for unmatched requests")
+	}
+	if reg.Counter(HTTPServerInFlight).Value() != 0 {
+		t.Errorf("wrong number of requests in flight: %d (0 expected)", reg.Counter(HTTPServerInFlight).Value())
+	}
+
+	sizes := reg.Histogram(HTTPServerResponseSize).snapshot()
+	if sizes.Count() != 3 || sizes.Minimum() != 5 {
+		t.Errorf("wrong response sizes: count=%d, min=%f (3/5 expected)", sizes.Count(), sizes.Minimum())
+	}
+}
+
+func TestPatternRouteNamer(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"", "unmatched"},
+		{"/users/{id}", "/users/{id}"},
+		{"GET /users/{id}", "/users/{id}"},
+		{"GET example.com/users/", "/users/"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Pattern = test.pattern
+		if route := PatternRouteNamer(r); route != test.expected {
+			t.Errorf("wrong route for %q: %q (%q expected)", test.pattern, route, test.expected)
+		}
+	}
+}
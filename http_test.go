@@ -0,0 +1,145 @@
+package quant
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPMiddlewareCustomRoutes(t *testing.T) {
+	reg := NewRegistry("reg")
+	handler := HTTPMiddlewareWithRoutes(reg, http.NotFoundHandler(), func(r *http.Request) string {
+		return "static"
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/a/b", nil))
+	if reg.Timer("http.server.requests.static.POST.4xx") == nil {
+		t.Error("no timer for custom route")
+	}
+}
+
+func TestHTTPMiddlewareMethods(t *testing.T) {
+	reg := NewRegistry("reg")
+	handler := HTTPMiddlewareWithRoutes(reg, http.NotFoundHandler(), func(r *http.Request) string {
+		return "static"
+	})
+
+	for _, method := range []string{"GET", "FOO", "BAR"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+	if reg.Timer("http.server.requests.static.GET.4xx") == nil {
+		t.Error("no timer for standard method")
+	}
+	if timer := reg.Timer("http.server.requests.static.other.4xx"); timer == nil || timer.snapshot().Count() != 2 {
+		t.Error("non-standard methods are not recorded as other")
+	}
+	if reg.Contains("http.server.requests.static.FOO.4xx") {
+		t.Error("timer created for non-standard method")
+	}
+}
+
+func TestHTTPMiddlewareNameCollision(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("http.server.requests.static.GET.4xx")
+	handler := HTTPMiddlewareWithRoutes(reg, http.NotFoundHandler(), func(r *http.Request) string {
+		return "static"
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if reg.Timer("http.server.requests.static.GET.4xx") != nil {
+		t.Error("timer created for existing counter name")
+	}
+}
+
+func TestHTTPMiddlewareReadFrom(t *testing.T) {
+	reg := NewRegistry("reg")
+	handler := HTTPMiddleware(reg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, strings.NewReader("hello world"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Body.String() != "hello world" {
+		t.Errorf("wrong body: %q (%q expected)", rec.Body.String(), "hello world")
+	}
+	if sizes := reg.Histogram(HTTPServerResponseSize).snapshot(); sizes.Maximum() != 11 {
+		t.Errorf("wrong response size: %f (11 expected)", sizes.Maximum())
+	}
+}
+
+func TestHTTPMiddlewareHijack(t *testing.T) {
+	var hijackable bool
+	reg := NewRegistry("reg")
+	handler := HTTPMiddlewareWithRoutes(reg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		hijackable = ok
+		if ok {
+			conn, _, err := hj.Hijack()
+			if err != nil {
+				t.Fatalf("unexpected hijack error: %v", err)
+			}
+			conn.Close()
+		}
+	}), func(r *http.Request) string {
+		return "ws"
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if hijackable {
+		t.Error("writer without Hijack support is a http.Hijacker")
+	}
+
+	handler.ServeHTTP(&hijackableRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	if !hijackable {
+		t.Error("writer with Hijack support is not a http.Hijacker")
+	}
+	if reg.Timer("http.server.requests.ws.GET.1xx") == nil {
+		t.Error("no timer for hijacked request")
+	}
+}
+
+func TestHTTPMiddlewareFlush(t *testing.T) {
+	var flushable bool
+	reg := NewRegistry("reg")
+	handler := HTTPMiddleware(reg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		flushable = ok
+		if ok {
+			f.Flush()
+		}
+	}))
+
+	handler.ServeHTTP(nonFlushingRecorder{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	if flushable {
+		t.Error("writer without Flush support is a http.Flusher")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !flushable || !rec.Flushed {
+		t.Error("writer with Flush support is not flushed")
+	}
+}
+
+// nonFlushingRecorder hides the Flush method of the recorder.
+type nonFlushingRecorder struct {
+	rec *httptest.ResponseRecorder
+}
+
+func (r nonFlushingRecorder) Header() http.Header         { return r.rec.Header() }
+func (r nonFlushingRecorder) Write(p []byte) (int, error) { return r.rec.Write(p) }
+func (r nonFlushingRecorder) WriteHeader(code int)        { r.rec.WriteHeader(code) }
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
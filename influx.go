@@ -0,0 +1,347 @@
+package quant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultQuantiles are the quantiles reporters write for timers and
+// histograms unless configured otherwise.
+var DefaultQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+var errInfluxNotConfigured = errors.New("influx reporter has no destination, use a constructor")
+
+// Defaults for the batching of InfluxReporter.
+const (
+	DefaultInfluxBatchSize = 5000
+	influxUDPPayloadSize   = 1400
+)
+
+// InfluxReporter is a Reporter implementation that writes the metric
+// snapshots in the InfluxDB line protocol. The measurement of each point
+// is the metric name, and each point is tagged with the registry name
+// ("registry") and the metric unit ("unit"). Tags with empty values are
+// omitted, since they are invalid in the line protocol.
+// Counters and gauges are written with a single field "value". Timers and
+// histograms are written with the fields "count", "min", "max", "mean",
+// "stddev" and one field per quantile (e.g. "p99" for the 0.99-quantile).
+// Values which cannot be represented (NaN, infinity) are omitted.
+//
+// The exported fields configure the reporter and must not be changed
+// once the reporter is in use. A reporter must be created with one of
+// the constructors, the zero value returns an error on each report.
+type InfluxReporter struct {
+	// Quantiles contains the quantiles written for timers and histograms.
+	Quantiles []float64
+	// BatchSize is the maximum number of points written with a single
+	// HTTP request.
+	BatchSize int
+	// Gzip enables the gzip compression of HTTP requests.
+	Gzip bool
+	// Client is the HTTP client used for writing the points. If it is nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	write func(r *InfluxReporter, points []byte) error
+	url   string
+	token string
+	conn  net.Conn
+}
+
+// NewInfluxReporter creates a new InfluxDB reporter which writes the
+// points to the given database using the /write endpoint of InfluxDB v1.
+// The url is the base URL of the server, e.g. "http://localhost:8086".
+func NewInfluxReporter(serverURL, database string) *InfluxReporter {
+	query := url.Values{"db": {database}, "precision": {"ns"}}
+	return &InfluxReporter{
+		Quantiles: DefaultQuantiles,
+		BatchSize: DefaultInfluxBatchSize,
+		Gzip:      true,
+		write:     (*InfluxReporter).writeHTTP,
+		url:       strings.TrimRight(serverURL, "/") + "/write?" + query.Encode(),
+	}
+}
+
+// NewInfluxV2Reporter creates a new InfluxDB reporter which writes the
+// points to the given bucket using the /api/v2/write endpoint of InfluxDB v2.
+// The url is the base URL of the server, e.g. "http://localhost:8086".
+func NewInfluxV2Reporter(serverURL, org, bucket, token string) *InfluxReporter {
+	query := url.Values{"org": {org}, "bucket": {bucket}, "precision": {"ns"}}
+	return &InfluxReporter{
+		Quantiles: DefaultQuantiles,
+		BatchSize: DefaultInfluxBatchSize,
+		Gzip:      true,
+		write:     (*InfluxReporter).writeHTTP,
+		url:       strings.TrimRight(serverURL, "/") + "/api/v2/write?" + query.Encode(),
+		token:     token,
+	}
+}
+
+// NewInfluxUDPReporter creates a new InfluxDB reporter which writes the
+// points to the UDP listener at the given address. The points are batched
+// into datagrams of a limited size. BatchSize and Gzip have no effect.
+func NewInfluxUDPReporter(addr string) (*InfluxReporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &InfluxReporter{
+		Quantiles: DefaultQuantiles,
+		write:     (*InfluxReporter).writeUDP,
+		conn:      conn,
+	}, nil
+}
+
+// Close releases the resources of the reporter.
+func (r *InfluxReporter) Close() error {
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+// ReportCounters writes the counter snapshots.
+func (r *InfluxReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	ts := time.Now().UnixNano()
+	points := make([][]byte, 0, len(counters))
+	for _, c := range counters {
+		p := newInfluxPoint(c.Name(), registryName, c.Unit())
+		if c.IsFloat() {
+			p.floatField("value", c.FloatValue())
+		} else {
+			p.intField("value", c.Value())
+		}
+		points = p.append(points, ts)
+	}
+	return r.writeBatches(points)
+}
+
+// ReportGauges writes the gauge snapshots. Gauges which could not be
+// read are skipped.
+func (r *InfluxReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	ts := time.Now().UnixNano()
+	points := make([][]byte, 0, len(gauges))
+	for _, g := range gauges {
+		if g.Err() != nil {
+			continue
+		}
+		p := newInfluxPoint(g.Name(), registryName, g.Unit())
+		if g.IsInt() {
+			p.intField("value", g.IntValue())
+		} else {
+			p.floatField("value", g.Value())
+		}
+		points = p.append(points, ts)
+	}
+	return r.writeBatches(points)
+}
+
+// ReportTimers writes the timer snapshots.
+func (r *InfluxReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	ts := time.Now().UnixNano()
+	points := make([][]byte, 0, len(timers))
+	for _, t := range timers {
+		points = r.reservoirPoint(registryName, &t.reservoirSnapshot).append(points, ts)
+	}
+	return r.writeBatches(points)
+}
+
+// ReportHistograms writes the histogram snapshots.
+func (r *InfluxReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	ts := time.Now().UnixNano()
+	points := make([][]byte, 0, len(histograms))
+	for _, h := range histograms {
+		points = r.reservoirPoint(registryName, &h.reservoirSnapshot).append(points, ts)
+	}
+	return r.writeBatches(points)
+}
+
+func (r *InfluxReporter) reservoirPoint(registryName string, s *reservoirSnapshot) *influxPoint {
+	p := newInfluxPoint(s.Name(), registryName, s.Unit())
+	p.intField("count", int64(s.Count()))
+	if s.Count() != 0 {
+		p.floatField("min", s.Minimum())
+		p.floatField("max", s.Maximum())
+		p.floatField("mean", s.Average())
+		p.floatField("stddev", s.StdDeviation())
+		for _, q := range r.Quantiles {
+			p.floatField(quantileName(q), s.Quantile(q))
+		}
+	}
+	return p
+}
+
+func (r *InfluxReporter) writeBatches(points [][]byte) error {
+	if r.write == nil {
+		return errInfluxNotConfigured
+	}
+	for len(points) != 0 {
+		n := r.batchLen(points)
+		if err := r.write(r, bytes.Join(points[:n], nil)); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+// batchLen returns the number of points written with the next batch.
+func (r *InfluxReporter) batchLen(points [][]byte) int {
+	if r.conn != nil {
+		// UDP: fill a datagram, but write at least one point
+		n, size := 1, len(points[0])
+		for n < len(points) && size+len(points[n]) <= influxUDPPayloadSize {
+			size += len(points[n])
+			n++
+		}
+		return n
+	}
+
+	n := r.BatchSize
+	if n <= 0 {
+		n = DefaultInfluxBatchSize
+	}
+	if n > len(points) {
+		n = len(points)
+	}
+	return n
+}
+
+func (r *InfluxReporter) writeHTTP(points []byte) error {
+	var body io.Reader = bytes.NewReader(points)
+	if r.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(points)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = &buf
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if r.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "Token "+r.token)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("influx write failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (r *InfluxReporter) writeUDP(points []byte) error {
+	_, err := r.conn.Write(points)
+	return err
+}
+
+// influxPoint builds a single line of the line protocol.
+type influxPoint struct {
+	buf    []byte
+	fields int
+}
+
+func newInfluxPoint(measurement, registryName, unit string) *influxPoint {
+	p := &influxPoint{}
+	p.buf = appendInfluxEscaped(p.buf, measurement, ", ")
+	if registryName != "" {
+		p.buf = append(p.buf, ",registry="...)
+		p.buf = appendInfluxEscaped(p.buf, registryName, ",= ")
+	}
+	if unit != "" {
+		p.buf = append(p.buf, ",unit="...)
+		p.buf = appendInfluxEscaped(p.buf, unit, ",= ")
+	}
+	return p
+}
+
+func (p *influxPoint) fieldKey(key string) {
+	if p.fields == 0 {
+		p.buf = append(p.buf, ' ')
+	} else {
+		p.buf = append(p.buf, ',')
+	}
+	p.fields++
+	p.buf = appendInfluxEscaped(p.buf, key, ",= ")
+	p.buf = append(p.buf, '=')
+}
+
+func (p *influxPoint) intField(key string, value int64) {
+	p.fieldKey(key)
+	p.buf = strconv.AppendInt(p.buf, value, 10)
+	p.buf = append(p.buf, 'i')
+}
+
+func (p *influxPoint) floatField(key string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	p.fieldKey(key)
+	p.buf = strconv.AppendFloat(p.buf, value, 'g', -1, 64)
+}
+
+// append appends the finished line to lines. Points without fields
+// are not valid and therefore dropped.
+func (p *influxPoint) append(lines [][]byte, ts int64) [][]byte {
+	if p.fields == 0 {
+		return lines
+	}
+	p.buf = append(p.buf, ' ')
+	p.buf = strconv.AppendInt(p.buf, ts, 10)
+	p.buf = append(p.buf, '\n')
+	return append(lines, p.buf)
+}
+
+// appendInfluxEscaped appends s to buf and escapes all characters in
+// special as well as backslashes. Newlines cannot be escaped in the
+// line protocol and are therefore replaced by escaped spaces. The
+// special characters must contain the space character.
+func appendInfluxEscaped(buf []byte, s string, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\n' || c == '\r':
+			buf = append(buf, '\\', ' ')
+		case c == '\\' || strings.IndexByte(special, c) >= 0:
+			buf = append(buf, '\\', c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
+
+// quantileName returns the field name of a quantile, e.g. "p99" for
+// 0.99 or "p999" for 0.999.
+func quantileName(q float64) string {
+	s := strconv.FormatFloat(math.Round(q*1e6)/1e4, 'f', -1, 64)
+	return "p" + strings.Replace(s, ".", "", 1)
+}
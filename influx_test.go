@@ -0,0 +1,159 @@
+package quant
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxReporter(t *testing.T) {
+	var mtx sync.Mutex
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/write" || r.URL.Query().Get("db") != "metrics" {
+			t.Errorf("wrong write URL: %s", r.URL)
+		}
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatalf("invalid gzip body: %v", err)
+			}
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+
+		mtx.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+		mtx.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry("my registry")
+	reg.NewCounter("requests,total").Add(3)
+	reg.NewGaugeWithUnit("memory", "MB", func() float64 { return 1.5 })
+	timer := reg.NewTimer("latency", Milliseconds)
+	timer.Update(time.Millisecond)
+	timer.Update(3 * time.Millisecond)
+
+	r := NewInfluxReporter(srv.URL, "metrics")
+	r.Quantiles = []float64{0.5}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	expected := []string{
+		`requests\,total,registry=my\ registry value=3i `,
+		`memory,registry=my\ registry,unit=MB value=1.5 `,
+		`latency,registry=my\ registry,unit=ms count=2i,min=1,max=3,mean=2,stddev=1,p50=2 `,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines: %d (%d expected)", len(lines), len(expected))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("wrong line: %q (%q expected)", line, expected[i])
+		}
+	}
+}
+
+func TestInfluxV2ReporterBatches(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path != "/api/v2/write":
+			t.Errorf("wrong write path: %s", r.URL.Path)
+		case r.URL.Query().Get("bucket") != "my-bucket" || r.URL.Query().Get("org") != "my-org":
+			t.Errorf("wrong write query: %s", r.URL.RawQuery)
+		case r.Header.Get("Authorization") != "Token secret":
+			t.Errorf("wrong authorization header: %s", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry("reg")
+	for _, name := range []string{"a", "b", "c"} {
+		reg.NewCounter(name)
+	}
+
+	r := NewInfluxV2Reporter(srv.URL, "my-org", "my-bucket", "secret")
+	r.BatchSize = 2
+	r.Gzip = false
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("wrong number of requests: %d (2 expected)", requests)
+	}
+}
+
+func TestInfluxUDPReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	r, err := NewInfluxUDPReporter(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	reg := NewRegistry("reg")
+	reg.NewSettableGauge("my-gauge").Set(7)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := string(buf[:n]); !strings.HasPrefix(line, "my-gauge,registry=reg value=7 ") {
+		t.Errorf("wrong line: %q", line)
+	}
+}
+
+func TestInfluxReporterZeroValue(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("requests").Add(1)
+	if err := reg.Report(&InfluxReporter{}); err == nil {
+		t.Error("no error for zero value reporter")
+	}
+}
+
+func TestInfluxPointEmptyTags(t *testing.T) {
+	p := newInfluxPoint("requests", "", "")
+	p.intField("value", 1)
+	lines := p.append(nil, 42)
+	if expected := "requests value=1i 42\n"; len(lines) != 1 || string(lines[0]) != expected {
+		t.Errorf("wrong line: %q (%q expected)", lines, expected)
+	}
+}
+
+func TestQuantileName(t *testing.T) {
+	tests := map[float64]string{
+		0.5:   "p50",
+		0.75:  "p75",
+		0.95:  "p95",
+		0.99:  "p99",
+		0.999: "p999",
+	}
+	for q, expected := range tests {
+		if name := quantileName(q); name != expected {
+			t.Errorf("wrong quantile name for %f: %s (%s expected)", q, name, expected)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package quant
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Temporality represents the aggregation temporality reporters use
+// for counters, timers and histograms.
+type Temporality int
+
+// All available temporalities. With cumulative temporality the values
+// are accumulated since the start of the reporting, whereas with delta
+// temporality only the changes since the previous report are written.
+const (
+	CumulativeTemporality Temporality = iota
+	DeltaTemporality
+)
+
+// String returns a string representation of the temporality.
+func (t Temporality) String() string {
+	switch t {
+	case CumulativeTemporality:
+		return "cumulative"
+	case DeltaTemporality:
+		return "delta"
+	default:
+		return fmt.Sprintf("Temporality(%d)", int(t))
+	}
+}
+
+// DefaultOTLPEndpoint is the default endpoint of an OTLP/HTTP collector.
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/metrics"
+
+// OTLP aggregation temporality enum values.
+const (
+	otlpDelta      = 1
+	otlpCumulative = 2
+)
+
+// OTLPReporter is a Reporter implementation that exports the metric
+// snapshots to an OpenTelemetry collector using OTLP/HTTP with protobuf
+// encoding. Counters are exported as sums, gauges as gauges, and timers
+// and histograms as histograms with count, sum, minimum and maximum.
+// Each data point carries the resource attributes "service.name" and
+// "quant.registry".
+//
+// The exported fields configure the reporter and must not be changed
+// once the reporter is in use. The zero value is a reporter which posts
+// the metrics to DefaultOTLPEndpoint using cumulative temporality.
+type OTLPReporter struct {
+	// Endpoint is the URL the metrics are posted to. If it is empty,
+	// DefaultOTLPEndpoint is used.
+	Endpoint string
+	// ServiceName is used for the "service.name" resource attribute.
+	ServiceName string
+	// Temporality specifies the aggregation temporality of counters,
+	// timers and histograms.
+	Temporality Temporality
+	// Client is the HTTP client used to post the metrics. If it is nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+	// Header contains additional HTTP headers which are sent with each
+	// request, e.g. for authentication.
+	Header http.Header
+
+	mtx     sync.Mutex
+	start   time.Time                     // start of the reporting, set on first use
+	starts  map[string]time.Time          // start times of the cumulative metrics
+	reports map[string]time.Time          // last report per registry and metric kind
+	totals  map[string]*reservoirSnapshot // accumulated timers and histograms
+}
+
+// NewOTLPReporter creates a new OTLP reporter which posts the metrics
+// to the given endpoint using cumulative temporality.
+func NewOTLPReporter(endpoint, serviceName string) *OTLPReporter {
+	r := &OTLPReporter{
+		Endpoint:    endpoint,
+		ServiceName: serviceName,
+		Temporality: CumulativeTemporality,
+	}
+	r.init()
+	return r
+}
+
+// init initializes the reporting state if this was not done yet, e.g.
+// for reporters which were not created by NewOTLPReporter. The caller
+// must hold the lock unless the reporter is not shared yet.
+func (r *OTLPReporter) init() {
+	if r.starts != nil {
+		return
+	}
+	r.start = time.Now()
+	r.starts = make(map[string]time.Time)
+	r.reports = make(map[string]time.Time)
+	r.totals = make(map[string]*reservoirSnapshot)
+}
+
+// ReportCounters exports the counter snapshots as OTLP sums. Monotonic
+// counters are exported as monotonic sums.
+func (r *OTLPReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	r.init()
+	metrics := make([]func(*protoBuffer), len(counters))
+	for i, c := range counters {
+		ts := c.Time()
+		if ts.IsZero() {
+			ts = now
+		}
+
+		var start time.Time
+		value := c.FloatValue()
+		intValue := c.Value()
+		if r.Temporality == DeltaTemporality {
+			start = c.PreviousTime()
+			if start.IsZero() {
+				start = r.start
+			}
+			value, intValue = c.FloatDelta(), c.Delta()
+		} else {
+			start = r.startTime(registryName, c.Name(), ts)
+		}
+
+		c := c
+		metrics[i] = func(b *protoBuffer) {
+			r.encodeMetricHeader(b, c.Name(), c.Unit())
+			b.messageField(7, func(b *protoBuffer) { // sum
+				b.messageField(1, func(b *protoBuffer) { // data point
+					b.fixed64Field(2, uint64(start.UnixNano()))
+					b.fixed64Field(3, uint64(ts.UnixNano()))
+					if c.IsFloat() {
+						b.doubleField(4, value)
+					} else {
+						b.sfixed64Field(6, intValue)
+					}
+				})
+				b.uint64Field(2, r.otlpTemporality())
+				b.boolField(3, c.Monotonic())
+			})
+		}
+	}
+	r.mtx.Unlock()
+	return r.export(registryName, metrics)
+}
+
+// ReportGauges exports the gauge snapshots as OTLP gauges. Gauges which
+// could not be read are skipped.
+func (r *OTLPReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	now := uint64(time.Now().UnixNano())
+	metrics := make([]func(*protoBuffer), 0, len(gauges))
+	for _, g := range gauges {
+		if g.Err() != nil {
+			continue
+		}
+
+		g := g
+		metrics = append(metrics, func(b *protoBuffer) {
+			r.encodeMetricHeader(b, g.Name(), g.Unit())
+			b.messageField(5, func(b *protoBuffer) { // gauge
+				b.messageField(1, func(b *protoBuffer) { // data point
+					b.fixed64Field(3, now)
+					if g.IsInt() {
+						b.sfixed64Field(6, g.IntValue())
+					} else {
+						b.doubleField(4, g.Value())
+					}
+				})
+			})
+		})
+	}
+	return r.export(registryName, metrics)
+}
+
+// ReportTimers exports the timer snapshots as OTLP histograms.
+func (r *OTLPReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	snaps := make([]*reservoirSnapshot, len(timers))
+	for i, t := range timers {
+		snaps[i] = &t.reservoirSnapshot
+	}
+	return r.reportReservoirs(registryName, "timers", snaps)
+}
+
+// ReportHistograms exports the histogram snapshots as OTLP histograms.
+func (r *OTLPReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	snaps := make([]*reservoirSnapshot, len(histograms))
+	for i, h := range histograms {
+		snaps[i] = &h.reservoirSnapshot
+	}
+	return r.reportReservoirs(registryName, "histograms", snaps)
+}
+
+// reportReservoirs exports timer or histogram snapshots. The snapshots
+// only contain the values since the previous report. So for delta
+// temporality they are exported as they are, whereas for cumulative
+// temporality they are accumulated first.
+func (r *OTLPReporter) reportReservoirs(registryName, kind string, snaps []*reservoirSnapshot) error {
+	now := time.Now()
+	r.mtx.Lock()
+	r.init()
+	reportKey := registryName + "\x00" + kind
+	prev, ok := r.reports[reportKey]
+	if !ok {
+		prev = r.start
+	}
+	r.reports[reportKey] = now
+
+	metrics := make([]func(*protoBuffer), len(snaps))
+	for i, s := range snaps {
+		s := s
+		start := prev
+		if r.Temporality == CumulativeTemporality {
+			key := registryName + "\x00" + s.Name()
+			total := r.totals[key]
+			if total == nil || checkMergeBuckets(total, s) != nil {
+				// changed bucket bounds start a new histogram
+				if total != nil {
+					r.starts[key] = now
+				}
+				total = newReservoirSnaphot(s.name, s.unit)
+				r.totals[key] = total
+			}
+			total.merge(s)
+			s = &reservoirSnapshot{}
+			*s = *total
+			s.buckets = total.buckets.clone()
+			start = r.startTime(registryName, s.Name(), now)
+		}
+
+		metrics[i] = func(b *protoBuffer) {
+			r.encodeMetricHeader(b, s.Name(), s.Unit())
+			b.messageField(9, func(b *protoBuffer) { // histogram
+				b.messageField(1, func(b *protoBuffer) { // data point
+					b.fixed64Field(2, uint64(start.UnixNano()))
+					b.fixed64Field(3, uint64(now.UnixNano()))
+					b.fixed64Field(4, uint64(s.Count()))
+					b.doubleField(5, s.sum)
+					if s.buckets != nil {
+						b.packedFixed64Field(6, s.buckets.counts)
+						b.packedDoubleField(7, s.buckets.bounds)
+					} else {
+						b.packedFixed64Field(6, []uint64{uint64(s.Count())})
+					}
+					if s.Count() != 0 {
+						b.doubleField(11, s.Minimum())
+						b.doubleField(12, s.Maximum())
+					}
+				})
+				b.uint64Field(2, r.otlpTemporality())
+			})
+		}
+	}
+	r.mtx.Unlock()
+	return r.export(registryName, metrics)
+}
+
+// startTime returns the start time of a cumulative metric. The caller
+// must hold the lock.
+func (r *OTLPReporter) startTime(registryName, name string, now time.Time) time.Time {
+	key := registryName + "\x00" + name
+	start, ok := r.starts[key]
+	if !ok {
+		start = now
+		if r.start.Before(now) {
+			start = r.start
+		}
+		r.starts[key] = start
+	}
+	return start
+}
+
+func (r *OTLPReporter) otlpTemporality() uint64 {
+	if r.Temporality == DeltaTemporality {
+		return otlpDelta
+	}
+	return otlpCumulative
+}
+
+func (r *OTLPReporter) encodeMetricHeader(b *protoBuffer, name, unit string) {
+	b.stringField(1, name)
+	b.stringField(3, otlpUnit(unit))
+}
+
+// export encodes an ExportMetricsServiceRequest containing the given
+// metrics and posts it to the configured endpoint.
+func (r *OTLPReporter) export(registryName string, metrics []func(*protoBuffer)) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var req protoBuffer
+	req.messageField(1, func(b *protoBuffer) { // resource metrics
+		b.messageField(1, func(b *protoBuffer) { // resource
+			encodeOTLPAttribute(b, 1, "service.name", r.ServiceName)
+			encodeOTLPAttribute(b, 1, "quant.registry", registryName)
+		})
+		b.messageField(2, func(b *protoBuffer) { // scope metrics
+			b.messageField(1, func(b *protoBuffer) { // scope
+				b.stringField(1, "github.com/tsne/quant")
+			})
+			for _, m := range metrics {
+				b.messageField(2, m)
+			}
+		})
+	})
+
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(req.bytes()))
+	if err != nil {
+		return err
+	}
+	for key, values := range r.Header {
+		httpReq.Header[key] = values
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp export failed: %s", resp.Status)
+	}
+	return nil
+}
+
+func encodeOTLPAttribute(b *protoBuffer, field int, key, value string) {
+	b.messageField(field, func(b *protoBuffer) {
+		b.stringField(1, key)
+		b.messageField(2, func(b *protoBuffer) {
+			b.stringField(1, value)
+		})
+	})
+}
+
+// otlpUnit converts a unit into its UCUM representation as far as
+// it is known.
+func otlpUnit(unit string) string {
+	switch unit {
+	case "µs":
+		return "us"
+	case "B":
+		return "By"
+	default:
+		return unit
+	}
+}
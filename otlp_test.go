@@ -0,0 +1,293 @@
+package quant
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestOTLPReporterCumulative(t *testing.T) {
+	collector := newTestCollector()
+	defer collector.Close()
+
+	reg := NewRegistry("reg")
+	counter := reg.NewMonotonicCounter("my-counter")
+	timer := reg.NewTimer("my-timer", Milliseconds)
+	r := NewOTLPReporter(collector.URL, "my-service")
+
+	counter.Add(2)
+	timer.Update(1000000)
+	reg.Report(r)
+	counter.Add(3)
+	timer.Update(3000000)
+	reg.Report(r)
+
+	sums := collector.metrics("my-counter", 7)
+	if len(sums) != 2 {
+		t.Fatalf("wrong number of exported sums: %d (2 expected)", len(sums))
+	}
+	first, second := sums[0], sums[1]
+	if v := int64(second.field(1).field(6).fixed); v != 5 {
+		t.Errorf("wrong cumulative sum: %d (5 expected)", v)
+	}
+	if second.field(2).varint != otlpCumulative {
+		t.Errorf("wrong temporality: %d (%d expected)", second.field(2).varint, otlpCumulative)
+	}
+	if second.field(3).varint != 1 {
+		t.Error("monotonic counter is not exported as monotonic sum")
+	}
+	if first.field(1).field(2).fixed != second.field(1).field(2).fixed {
+		t.Error("start time of cumulative sum changed")
+	}
+
+	histograms := collector.metrics("my-timer", 9)
+	if len(histograms) != 2 {
+		t.Fatalf("wrong number of exported histograms: %d (2 expected)", len(histograms))
+	}
+	point := histograms[1].field(1)
+	if point.field(4).fixed != 2 {
+		t.Errorf("wrong cumulative histogram count: %d (2 expected)", point.field(4).fixed)
+	}
+	if sum := math.Float64frombits(point.field(5).fixed); sum != 4 {
+		t.Errorf("wrong cumulative histogram sum: %f (4 expected)", sum)
+	}
+	if max := math.Float64frombits(point.field(12).fixed); max != 3 {
+		t.Errorf("wrong cumulative histogram maximum: %f (3 expected)", max)
+	}
+
+	if attrs := collector.resourceAttributes(); attrs["service.name"] != "my-service" || attrs["quant.registry"] != "reg" {
+		t.Errorf("wrong resource attributes: %v", attrs)
+	}
+}
+
+func TestOTLPReporterDelta(t *testing.T) {
+	collector := newTestCollector()
+	defer collector.Close()
+
+	reg := NewRegistry("reg")
+	counter := reg.NewFloatCounter("my-counter")
+	timer := reg.NewTimer("my-timer", Milliseconds)
+	reg.NewIntGauge("my-gauge", func() int64 { return 7 })
+	r := NewOTLPReporter(collector.URL, "my-service")
+	r.Temporality = DeltaTemporality
+
+	counter.Add(2)
+	timer.Update(1000000)
+	reg.Report(r)
+	counter.Add(0.5)
+	timer.Update(3000000)
+	reg.Report(r)
+
+	sums := collector.metrics("my-counter", 7)
+	if len(sums) != 2 {
+		t.Fatalf("wrong number of exported sums: %d (2 expected)", len(sums))
+	}
+	if v := math.Float64frombits(sums[1].field(1).field(4).fixed); v != 0.5 {
+		t.Errorf("wrong delta sum: %f (0.5 expected)", v)
+	}
+	if sums[1].field(2).varint != otlpDelta {
+		t.Errorf("wrong temporality: %d (%d expected)", sums[1].field(2).varint, otlpDelta)
+	}
+	if sums[1].field(3).varint != 0 {
+		t.Error("up/down counter is exported as monotonic sum")
+	}
+	if sums[1].field(1).field(2).fixed != sums[0].field(1).field(3).fixed {
+		t.Error("delta sum does not start at the previous report")
+	}
+
+	histograms := collector.metrics("my-timer", 9)
+	if n := histograms[1].field(1).field(4).fixed; n != 1 {
+		t.Errorf("wrong delta histogram count: %d (1 expected)", n)
+	}
+
+	gauges := collector.metrics("my-gauge", 5)
+	if len(gauges) != 2 || int64(gauges[0].field(1).field(6).fixed) != 7 {
+		t.Error("wrong exported int gauge")
+	}
+}
+
+func TestOTLPReporterBuckets(t *testing.T) {
+	collector := newTestCollector()
+	defer collector.Close()
+
+	reg := NewRegistry("reg")
+	timer := reg.NewBucketedTimer("my-timer", Milliseconds, []float64{1, 10})
+	r := NewOTLPReporter(collector.URL, "my-service")
+
+	timer.Update(500000)
+	timer.Update(5000000)
+	reg.Report(r)
+	timer.Update(50000000)
+	reg.Report(r)
+
+	histograms := collector.metrics("my-timer", 9)
+	if len(histograms) != 2 {
+		t.Fatalf("wrong number of exported histograms: %d (2 expected)", len(histograms))
+	}
+	point := histograms[1].field(1)
+	counts, bounds := point.field(6).bytes, point.field(7).bytes
+	if len(counts) != 24 || len(bounds) != 16 {
+		t.Fatalf("wrong number of buckets: %d counts, %d bounds", len(counts)/8, len(bounds)/8)
+	}
+	for i, expected := range []uint64{1, 1, 1} {
+		if n := binary.LittleEndian.Uint64(counts[8*i:]); n != expected {
+			t.Errorf("wrong count of bucket %d: %d (%d expected)", i, n, expected)
+		}
+	}
+	for i, expected := range []float64{1, 10} {
+		if b := math.Float64frombits(binary.LittleEndian.Uint64(bounds[8*i:])); b != expected {
+			t.Errorf("wrong bound of bucket %d: %v (%v expected)", i, b, expected)
+		}
+	}
+}
+
+func TestOTLPReporterZeroValue(t *testing.T) {
+	collector := newTestCollector()
+	defer collector.Close()
+
+	reg := NewRegistry("reg")
+	reg.NewMonotonicCounter("my-counter").Add(2)
+	reg.NewTimer("my-timer", Milliseconds).Update(1000000)
+	r := &OTLPReporter{Endpoint: collector.URL}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	if len(collector.metrics("my-counter", 7)) != 1 || len(collector.metrics("my-timer", 9)) != 1 {
+		t.Error("metrics not exported by zero value reporter")
+	}
+}
+
+func TestOTLPReporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry("reg")
+	reg.NewCounter("my-counter")
+	if err := reg.Report(NewOTLPReporter(srv.URL, "my-service")); err == nil {
+		t.Error("no error for failed export")
+	}
+}
+
+// testCollector is an OTLP/HTTP collector which stores all requests.
+type testCollector struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	requests []protoMessage
+}
+
+func newTestCollector() *testCollector {
+	c := &testCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		c.mtx.Lock()
+		c.requests = append(c.requests, decodeProto(body))
+		c.mtx.Unlock()
+	}))
+	return c
+}
+
+// metrics returns the data messages (e.g. sum or gauge) of all exported
+// metrics with the given name in the order of their export.
+func (c *testCollector) metrics(name string, dataField int) []protoMessage {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var res []protoMessage
+	for _, req := range c.requests {
+		for _, rm := range req.fields(1) {
+			for _, sm := range rm.message().fields(2) {
+				for _, m := range sm.message().fields(2) {
+					msg := m.message()
+					if string(msg.field(1).bytes) == name {
+						res = append(res, msg.field(dataField).message())
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+func (c *testCollector) resourceAttributes() map[string]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	attrs := make(map[string]string)
+	for _, kv := range c.requests[0].field(1).field(1).message().fields(1) {
+		msg := kv.message()
+		attrs[string(msg.field(1).bytes)] = string(msg.field(2).field(1).bytes)
+	}
+	return attrs
+}
+
+type protoField struct {
+	num    int
+	varint uint64
+	fixed  uint64
+	bytes  []byte
+}
+
+func (f protoField) message() protoMessage {
+	return decodeProto(f.bytes)
+}
+
+func (f protoField) field(num int) protoField {
+	return f.message().field(num)
+}
+
+type protoMessage []protoField
+
+func (m protoMessage) fields(num int) []protoField {
+	var res []protoField
+	for _, f := range m {
+		if f.num == num {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func (m protoMessage) field(num int) protoField {
+	for _, f := range m {
+		if f.num == num {
+			return f
+		}
+	}
+	return protoField{}
+}
+
+func decodeProto(data []byte) protoMessage {
+	var msg protoMessage
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		data = data[n:]
+		f := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case protoVarint:
+			f.varint, n = binary.Uvarint(data)
+			data = data[n:]
+		case protoFixed64:
+			f.fixed = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoBytes:
+			l, n := binary.Uvarint(data)
+			f.bytes = data[n : n+int(l)]
+			data = data[n+int(l):]
+		default:
+			return msg
+		}
+		msg = append(msg, f)
+	}
+	return msg
+}
@@ -0,0 +1,164 @@
+package quant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Names of the gauges registered by RegisterProcessMetrics.
+const (
+	ProcessCPUUser        = "process.cpu.user"
+	ProcessCPUSystem      = "process.cpu.system"
+	ProcessMemoryResident = "process.memory.resident"
+	ProcessMemoryVirtual  = "process.memory.virtual"
+	ProcessFDsOpen        = "process.fds.open"
+	ProcessFDsMax         = "process.fds.max"
+	ProcessThreads        = "process.threads"
+	ProcessStartTime      = "process.start_time"
+)
+
+// clockTicks is the number of clock ticks per second the kernel uses
+// for the time values in /proc (USER_HZ). It is 100 on all supported
+// Linux architectures.
+const clockTicks = 100
+
+// registerProcessMetrics registers the process gauges which read their
+// values from the procfs mounted at root. All values are read by a single
+// reader call per report. Values which cannot be read are reported as NaN.
+func registerProcessMetrics(registry *Registry, root string) {
+	pagesize := float64(os.Getpagesize())
+	reader := func() map[string]float64 {
+		values := make(map[string]float64, 8)
+		readProcessStat(root, pagesize, values)
+		if n, err := countOpenFDs(root); err == nil {
+			values[ProcessFDsOpen] = n
+		}
+		if n, err := readMaxOpenFiles(root); err == nil {
+			values[ProcessFDsMax] = n
+		}
+		return values
+	}
+
+	registry.NewGaugeSetWithUnits(reader, map[string]string{
+		ProcessCPUUser:        "s",
+		ProcessCPUSystem:      "s",
+		ProcessMemoryResident: "B",
+		ProcessMemoryVirtual:  "B",
+		ProcessFDsOpen:        "",
+		ProcessFDsMax:         "",
+		ProcessThreads:        "",
+		ProcessStartTime:      "s",
+	})
+}
+
+// readProcessStat reads the CPU times, the memory usage, the number of
+// threads and the start time from <root>/self/stat. The start time is
+// reported in seconds since the Unix epoch and therefore needs the boot
+// time from <root>/stat.
+func readProcessStat(root string, pagesize float64, values map[string]float64) {
+	data, err := os.ReadFile(filepath.Join(root, "self", "stat"))
+	if err != nil {
+		return
+	}
+
+	// The second field contains the executable name in parentheses
+	// which may contain spaces. So the fields are split after the
+	// closing parenthesis, which results in the third field being
+	// the first one.
+	idx := bytes.LastIndexByte(data, ')')
+	if idx < 0 {
+		return
+	}
+	fields := strings.Fields(string(data[idx+1:]))
+	field := func(n int) (float64, bool) {
+		if n-3 >= len(fields) {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(fields[n-3], 64)
+		return v, err == nil
+	}
+
+	if v, ok := field(14); ok {
+		values[ProcessCPUUser] = v / clockTicks
+	}
+	if v, ok := field(15); ok {
+		values[ProcessCPUSystem] = v / clockTicks
+	}
+	if v, ok := field(20); ok {
+		values[ProcessThreads] = v
+	}
+	if v, ok := field(23); ok {
+		values[ProcessMemoryVirtual] = v
+	}
+	if v, ok := field(24); ok {
+		values[ProcessMemoryResident] = v * pagesize
+	}
+	if v, ok := field(22); ok {
+		if btime, err := readBootTime(root); err == nil {
+			values[ProcessStartTime] = btime + v/clockTicks
+		}
+	}
+}
+
+func readBootTime(root string) (float64, error) {
+	f, err := os.Open(filepath.Join(root, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "btime" {
+			return strconv.ParseFloat(fields[1], 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no boot time in %s", f.Name())
+}
+
+func countOpenFDs(root string) (float64, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "self", "fd"))
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(entries)), nil
+}
+
+func readMaxOpenFiles(root string) (float64, error) {
+	f, err := os.Open(filepath.Join(root, "self", "limits"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// Limit                     Soft Limit           Hard Limit           Units
+	// Max open files            1024                 4096                 files
+	const prefix = "Max open files"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		fields := strings.Fields(line[len(prefix):])
+		if len(fields) == 0 {
+			break
+		}
+		if fields[0] == "unlimited" {
+			return 0, fmt.Errorf("unlimited open files")
+		}
+		return strconv.ParseFloat(fields[0], 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no open files limit in %s", f.Name())
+}
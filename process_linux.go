@@ -0,0 +1,12 @@
+package quant
+
+// RegisterProcessMetrics registers a set of gauges for the statistics
+// of the current process: the user and system CPU time in seconds, the
+// resident and virtual memory in bytes, the number of open file descriptors
+// and their limit, the number of threads and the process start time in
+// seconds since the Unix epoch. All values are read from /proc/self once
+// per report.
+// If one of the gauge names already exists this function will panic.
+func RegisterProcessMetrics(registry *Registry) {
+	registerProcessMetrics(registry, "/proc")
+}
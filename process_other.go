@@ -0,0 +1,9 @@
+//go:build !linux
+
+package quant
+
+// RegisterProcessMetrics registers a set of gauges for the statistics
+// of the current process. Process metrics are only supported on Linux,
+// so on this system no gauges are registered.
+func RegisterProcessMetrics(registry *Registry) {
+}
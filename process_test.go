@@ -0,0 +1,41 @@
+package quant
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	reg := NewRegistry("reg")
+	registerProcessMetrics(reg, "testdata/proc")
+
+	values := make(map[string]float64)
+	reg.Report(&testReporter{
+		reportGauges: func(registryName string, gauges []*GaugeSnapshot) error {
+			for _, g := range gauges {
+				values[g.Name()] = g.Value()
+			}
+			return nil
+		},
+	})
+
+	pagesize := float64(os.Getpagesize())
+	expected := map[string]float64{
+		ProcessCPUUser:        2.5,
+		ProcessCPUSystem:      0.75,
+		ProcessMemoryResident: 2048 * pagesize,
+		ProcessMemoryVirtual:  104857600,
+		ProcessFDsOpen:        3,
+		ProcessFDsMax:         1024,
+		ProcessThreads:        12,
+		ProcessStartTime:      1700000015,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("wrong number of process gauges: %d (%d expected)", len(values), len(expected))
+	}
+	for name, exp := range expected {
+		if values[name] != exp {
+			t.Errorf("wrong value for %s: %f (%f expected)", name, values[name], exp)
+		}
+	}
+}
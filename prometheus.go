@@ -0,0 +1,474 @@
+package quant
+
+import (
+	"bytes"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Content types of the exposition formats served by PrometheusReporter.
+const (
+	PrometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// PrometheusReporter is a Reporter implementation that keeps the most
+// recent metric snapshots and exposes them to Prometheus. It implements
+// http.Handler to serve the metrics either in the classic Prometheus text
+// format or in the OpenMetrics format, depending on the Accept header of
+// the request.
+//
+// Monotonic counters are exposed as counters, all other counters and
+// gauges as gauges. Timers and histograms are accumulated over all
+// reports. In the Prometheus text format they are exposed as summaries,
+// where the quantiles are estimated from the most recent snapshot. In the
+// OpenMetrics format they are exposed as histograms, since exemplars are
+// only allowed on histogram buckets. Timers and histograms with explicit
+// buckets (see Registry.NewBucketedTimer) are exposed as histograms with
+// all their buckets in both formats. The OpenMetrics format additionally
+// contains the units of the metrics and the creation timestamps, which
+// refer to the first report of the respective metric.
+//
+// The metric names are sanitized to match the Prometheus naming rules
+// and suffixed with the metric unit. If the sanitized names of two
+// metrics of the same registry collide, only one of them is exposed.
+// The registry name is added as the label "registry".
+type PrometheusReporter struct {
+	// Quantiles contains the quantiles exposed for timers and histograms
+	// in the Prometheus text format.
+	Quantiles []float64
+
+	mtx     sync.RWMutex
+	metrics map[promKey]*promMetric
+}
+
+type promKey struct {
+	registry string
+	name     string
+}
+
+type promType int
+
+const (
+	promCounter promType = iota
+	promGauge
+	promSummary
+	promHistogram
+)
+
+type promMetric struct {
+	registry string
+	name     string
+	unit     string
+	typ      promType
+	created  time.Time
+	value    float64
+	total    *reservoirSnapshot // accumulated summary or histogram values
+	last     *reservoirSnapshot // most recent summary or histogram snapshot
+	exemplar *Exemplar
+}
+
+// NewPrometheusReporter creates a new Prometheus reporter.
+func NewPrometheusReporter() *PrometheusReporter {
+	return &PrometheusReporter{
+		Quantiles: DefaultQuantiles,
+		metrics:   make(map[promKey]*promMetric),
+	}
+}
+
+// ReportCounters stores the counter snapshots.
+func (r *PrometheusReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, c := range counters {
+		typ := promGauge
+		if c.Monotonic() {
+			typ = promCounter
+		}
+		r.metric(registryName, c.Name(), c.Unit(), typ).value = c.FloatValue()
+	}
+	return nil
+}
+
+// ReportGauges stores the gauge snapshots. Gauges which could not be
+// read are removed until they can be read again.
+func (r *PrometheusReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, g := range gauges {
+		if g.Err() != nil {
+			delete(r.metrics, promKey{registryName, g.Name()})
+			continue
+		}
+		r.metric(registryName, g.Name(), g.Unit(), promGauge).value = g.Value()
+	}
+	return nil
+}
+
+// ReportTimers accumulates the timer snapshots.
+func (r *PrometheusReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, t := range timers {
+		m := r.summary(registryName, &t.reservoirSnapshot)
+		if t.Exemplar() != nil {
+			m.exemplar = t.Exemplar()
+		}
+	}
+	return nil
+}
+
+// ReportHistograms accumulates the histogram snapshots.
+func (r *PrometheusReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for _, h := range histograms {
+		r.summary(registryName, &h.reservoirSnapshot)
+	}
+	return nil
+}
+
+// ServeHTTP writes the stored metrics in the format requested by the
+// Accept header. If the client accepts the OpenMetrics format it is
+// preferred over the Prometheus text format.
+func (r *PrometheusReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+	if acceptsOpenMetrics(req.Header.Get("Accept")) {
+		r.WriteOpenMetrics(&buf)
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+	} else {
+		r.WritePrometheus(&buf)
+		w.Header().Set("Content-Type", PrometheusContentType)
+	}
+	w.Write(buf.Bytes())
+}
+
+// WritePrometheus writes the stored metrics in the Prometheus text format.
+func (r *PrometheusReporter) WritePrometheus(buf *bytes.Buffer) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, family := range r.families() {
+		m := family.metrics[0]
+		switch m.typ {
+		case promCounter:
+			writePromType(buf, family.name+"_total", "counter")
+			for _, m := range family.metrics {
+				writePromSample(buf, family.name+"_total", m.registry, "", "", m.value)
+			}
+		case promGauge:
+			writePromType(buf, family.name, "gauge")
+			for _, m := range family.metrics {
+				writePromSample(buf, family.name, m.registry, "", "", m.value)
+			}
+		case promSummary:
+			writePromType(buf, family.name, "summary")
+			for _, m := range family.metrics {
+				for _, q := range r.Quantiles {
+					writePromSample(buf, family.name, m.registry, "quantile", promFloat(q), m.last.Quantile(q))
+				}
+				writePromSample(buf, family.name+"_sum", m.registry, "", "", m.total.sum)
+				writePromSample(buf, family.name+"_count", m.registry, "", "", float64(m.total.Count()))
+			}
+		case promHistogram:
+			writePromType(buf, family.name, "histogram")
+			for _, m := range family.metrics {
+				writePromBuckets(buf, family.name, m, nil)
+				writePromSample(buf, family.name+"_sum", m.registry, "", "", m.total.sum)
+				writePromSample(buf, family.name+"_count", m.registry, "", "", float64(m.total.Count()))
+			}
+		}
+	}
+}
+
+// WriteOpenMetrics writes the stored metrics in the OpenMetrics format.
+func (r *PrometheusReporter) WriteOpenMetrics(buf *bytes.Buffer) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	for _, family := range r.families() {
+		m := family.metrics[0]
+		switch m.typ {
+		case promCounter:
+			writePromType(buf, family.name, "counter")
+		case promGauge:
+			writePromType(buf, family.name, "gauge")
+		case promSummary, promHistogram:
+			writePromType(buf, family.name, "histogram")
+		}
+		if family.unit != "" {
+			buf.WriteString("# UNIT ")
+			buf.WriteString(family.name)
+			buf.WriteByte(' ')
+			buf.WriteString(family.unit)
+			buf.WriteByte('\n')
+		}
+
+		for _, m := range family.metrics {
+			created := float64(m.created.UnixNano()) / 1e9
+			switch m.typ {
+			case promCounter:
+				writePromSample(buf, family.name+"_total", m.registry, "", "", m.value)
+				writePromSample(buf, family.name+"_created", m.registry, "", "", created)
+			case promGauge:
+				writePromSample(buf, family.name, m.registry, "", "", m.value)
+			case promSummary, promHistogram:
+				writePromBuckets(buf, family.name, m, m.exemplar)
+				writePromSample(buf, family.name+"_count", m.registry, "", "", float64(m.total.Count()))
+				writePromSample(buf, family.name+"_sum", m.registry, "", "", m.total.sum)
+				writePromSample(buf, family.name+"_created", m.registry, "", "", created)
+			}
+		}
+	}
+	buf.WriteString("# EOF\n")
+}
+
+// metric returns the stored metric for the given registry and name. If
+// the metric does not exist or its type changed, a new one is created.
+// The caller must hold the write lock.
+func (r *PrometheusReporter) metric(registryName, name, unit string, typ promType) *promMetric {
+	if r.metrics == nil {
+		r.metrics = make(map[promKey]*promMetric)
+	}
+	key := promKey{registryName, name}
+	m := r.metrics[key]
+	if m == nil || m.typ != typ {
+		m = &promMetric{
+			registry: registryName,
+			name:     name,
+			unit:     unit,
+			typ:      typ,
+			created:  time.Now(),
+		}
+		r.metrics[key] = m
+	}
+	return m
+}
+
+func (r *PrometheusReporter) summary(registryName string, s *reservoirSnapshot) *promMetric {
+	typ := promSummary
+	if s.buckets != nil {
+		typ = promHistogram
+	}
+	m := r.metric(registryName, s.Name(), s.Unit(), typ)
+	if m.total == nil || checkMergeBuckets(m.total, s) != nil {
+		// changed bucket bounds start a new histogram
+		m.total = newReservoirSnaphot(s.name, s.unit)
+		m.created = time.Now()
+	}
+	m.total.merge(s)
+	m.last = s
+	return m
+}
+
+type promFamily struct {
+	name    string
+	unit    string
+	metrics []*promMetric
+}
+
+// families groups the stored metrics by their sanitized names. Metrics
+// which conflict with the type of their family are omitted, as well as
+// metrics whose sanitized name collides with another metric of the same
+// registry (e.g. "a.b" and "a_b"), since their series would be
+// indistinguishable. Of colliding metrics the one with the smallest
+// original name is kept. The families are sorted by name and the metrics
+// of each family by registry name.
+// The caller must hold the read lock.
+func (r *PrometheusReporter) families() []*promFamily {
+	byName := make(map[string]*promFamily)
+	for _, m := range r.metrics {
+		unit := promUnit(m.unit)
+		name := promName(m.name, unit, m.typ == promCounter)
+		family := byName[name]
+		if family == nil {
+			family = &promFamily{name: name, unit: unit}
+			byName[name] = family
+		}
+		family.metrics = append(family.metrics, m)
+	}
+
+	families := make([]*promFamily, 0, len(byName))
+	for _, family := range byName {
+		sort.Slice(family.metrics, func(i, j int) bool {
+			mi, mj := family.metrics[i], family.metrics[j]
+			if mi.registry != mj.registry {
+				return mi.registry < mj.registry
+			}
+			return mi.name < mj.name
+		})
+		typ := family.metrics[0].typ
+		metrics := family.metrics[:0]
+		for _, m := range family.metrics {
+			if m.typ == typ && (len(metrics) == 0 || metrics[len(metrics)-1].registry != m.registry) {
+				metrics = append(metrics, m)
+			}
+		}
+		family.metrics = metrics
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	return families
+}
+
+// promName converts a metric name into a valid Prometheus metric name
+// which ends with the given unit. For counters a "_total" suffix is
+// removed, since it is added during the exposition.
+func promName(name, unit string, counter bool) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+
+	res := b.String()
+	if counter {
+		res = strings.TrimSuffix(res, "_total")
+	}
+	if unit != "" && !strings.HasSuffix(res, "_"+unit) {
+		res += "_" + unit
+	}
+	return res
+}
+
+// promUnit converts a metric unit into a Prometheus unit name.
+func promUnit(unit string) string {
+	switch unit {
+	case "":
+		return ""
+	case "ns":
+		return "nanoseconds"
+	case "µs", "us":
+		return "microseconds"
+	case "ms":
+		return "milliseconds"
+	case "s":
+		return "seconds"
+	case "B":
+		return "bytes"
+	case "%":
+		return "percent"
+	}
+	return strings.ToLower(promName(unit, "", false))
+}
+
+func promFloat(v float64) string {
+	switch {
+	case v != v:
+		return "NaN"
+	case v > 1.7976931348623157e308:
+		return "+Inf"
+	case v < -1.7976931348623157e308:
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writePromType(buf *bytes.Buffer, name, typ string) {
+	buf.WriteString("# TYPE ")
+	buf.WriteString(name)
+	buf.WriteByte(' ')
+	buf.WriteString(typ)
+	buf.WriteByte('\n')
+}
+
+// writePromBuckets writes the cumulative buckets of a summary or histogram
+// metric. Summaries only have the +Inf bucket. The exemplar, if any, is
+// attached to the first bucket which contains its value.
+func writePromBuckets(buf *bytes.Buffer, name string, m *promMetric, exemplar *Exemplar) {
+	var buckets []Bucket
+	if m.typ == promHistogram && m.total.buckets != nil {
+		buckets = m.total.CumulativeBuckets()
+	}
+	if len(buckets) == 0 {
+		buckets = []Bucket{{UpperBound: math.Inf(1), Count: uint64(m.total.Count())}}
+	}
+	for _, b := range buckets {
+		var e *Exemplar
+		if exemplar != nil && (exemplar.Value <= b.UpperBound || math.IsInf(b.UpperBound, 1)) {
+			e, exemplar = exemplar, nil
+		}
+		writePromSampleWithExemplar(buf, name+"_bucket", m.registry, "le", promFloat(b.UpperBound), float64(b.Count), e)
+	}
+}
+
+func writePromSample(buf *bytes.Buffer, name, registryName, label, labelValue string, value float64) {
+	writePromSampleWithExemplar(buf, name, registryName, label, labelValue, value, nil)
+}
+
+func writePromSampleWithExemplar(buf *bytes.Buffer, name, registryName, label, labelValue string, value float64, exemplar *Exemplar) {
+	buf.WriteString(name)
+	buf.WriteString(`{registry="`)
+	writePromLabelValue(buf, registryName)
+	buf.WriteByte('"')
+	if label != "" {
+		buf.WriteByte(',')
+		buf.WriteString(label)
+		buf.WriteString(`="`)
+		writePromLabelValue(buf, labelValue)
+		buf.WriteByte('"')
+	}
+	buf.WriteString("} ")
+	buf.WriteString(promFloat(value))
+	if exemplar != nil {
+		buf.WriteString(` # {trace_id="`)
+		writePromLabelValue(buf, exemplar.TraceID)
+		buf.WriteString(`"} `)
+		buf.WriteString(promFloat(exemplar.Value))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(float64(exemplar.Time.UnixNano())/1e9, 'f', -1, 64))
+	}
+	buf.WriteByte('\n')
+}
+
+func writePromLabelValue(buf *bytes.Buffer, v string) {
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// acceptsOpenMetrics reports whether the given Accept header contains
+// the OpenMetrics media type with a non-zero quality.
+func acceptsOpenMetrics(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/openmetrics-text" {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package quant
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusReporter(t *testing.T) {
+	reg := NewRegistry("my \"registry\"")
+	reg.NewMonotonicCounter("http.requests").Add(3)
+	reg.NewCounter("queue.size").Add(-2)
+	reg.NewGaugeWithUnit("memory", "B", func() float64 { return 1.5 })
+	timer := reg.NewTimer("latency", Milliseconds)
+	timer.Update(time.Millisecond)
+	timer.Update(3 * time.Millisecond)
+
+	r := NewPrometheusReporter()
+	r.Quantiles = []float64{0.5}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	timer.Update(5 * time.Millisecond)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != PrometheusContentType {
+		t.Errorf("wrong content type: %s (%s expected)", ct, PrometheusContentType)
+	}
+
+	expected := strings.Join([]string{
+		`# TYPE http_requests_total counter`,
+		`http_requests_total{registry="my \"registry\""} 3`,
+		`# TYPE latency_milliseconds summary`,
+		`latency_milliseconds{registry="my \"registry\"",quantile="0.5"} 5`,
+		`latency_milliseconds_sum{registry="my \"registry\""} 9`,
+		`latency_milliseconds_count{registry="my \"registry\""} 3`,
+		`# TYPE memory_bytes gauge`,
+		`memory_bytes{registry="my \"registry\""} 1.5`,
+		`# TYPE queue_size gauge`,
+		`queue_size{registry="my \"registry\""} -2`,
+		``,
+	}, "\n")
+	if body := rec.Body.String(); body != expected {
+		t.Errorf("wrong exposition:\n%s\n(expected)\n%s", body, expected)
+	}
+}
+
+func TestPrometheusReporterOpenMetrics(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewMonotonicCounter("jobs_total").Add(2)
+	timer := reg.NewTimer("latency", Seconds)
+	timer.Start().RecordWithExemplar("4bf92f3577b34da6")
+
+	r := NewPrometheusReporter()
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != OpenMetricsContentType {
+		t.Errorf("wrong content type: %s (%s expected)", ct, OpenMetricsContentType)
+	}
+
+	lines := strings.Split(rec.Body.String(), "\n")
+	expected := []string{
+		`# TYPE jobs counter`,
+		`jobs_total{registry="reg"} 2`,
+		`jobs_created{registry="reg"} `,
+		`# TYPE latency_seconds histogram`,
+		`# UNIT latency_seconds seconds`,
+		`latency_seconds_bucket{registry="reg",le="+Inf"} 1 # {trace_id="4bf92f3577b34da6"} `,
+		`latency_seconds_count{registry="reg"} 1`,
+		`latency_seconds_sum{registry="reg"} `,
+		`latency_seconds_created{registry="reg"} `,
+		`# EOF`,
+		``,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines: %d (%d expected)\n%s", len(lines), len(expected), rec.Body.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("wrong line: %q (%q expected)", line, expected[i])
+		}
+	}
+}
+
+func TestPrometheusReporterBuckets(t *testing.T) {
+	reg := NewRegistry("reg")
+	timer := reg.NewBucketedTimer("latency", Seconds, []float64{0.5, 1})
+	timer.Update(100 * time.Millisecond)
+	timer.Start().RecordWithExemplar("4bf92f3577b34da6")
+	timer.Update(2 * time.Second)
+
+	r := NewPrometheusReporter()
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	timer.Update(700 * time.Millisecond)
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	expectPromLines(t, buf.String(), []string{
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{registry="reg",le="0.5"} 2`,
+		`latency_seconds_bucket{registry="reg",le="1"} 3`,
+		`latency_seconds_bucket{registry="reg",le="+Inf"} 4`,
+		`latency_seconds_sum{registry="reg"} 2.8`,
+		`latency_seconds_count{registry="reg"} 4`,
+		``,
+	})
+
+	buf.Reset()
+	r.WriteOpenMetrics(&buf)
+	expectPromLines(t, buf.String(), []string{
+		`# TYPE latency_seconds histogram`,
+		`# UNIT latency_seconds seconds`,
+		`latency_seconds_bucket{registry="reg",le="0.5"} 2 # {trace_id="4bf92f3577b34da6"} `,
+		`latency_seconds_bucket{registry="reg",le="1"} 3`,
+		`latency_seconds_bucket{registry="reg",le="+Inf"} 4`,
+		`latency_seconds_count{registry="reg"} 4`,
+		`latency_seconds_sum{registry="reg"} `,
+		`latency_seconds_created{registry="reg"} `,
+		`# EOF`,
+		``,
+	})
+}
+
+func TestPrometheusReporterZeroValue(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewMonotonicCounter("requests").Add(2)
+	reg.NewTimer("latency", Seconds).Update(time.Second)
+
+	r := &PrometheusReporter{Quantiles: []float64{0.5}}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	expectPromLines(t, buf.String(), []string{
+		`# TYPE latency_seconds summary`,
+		`latency_seconds{registry="reg",quantile="0.5"} 1`,
+		`latency_seconds_sum{registry="reg"} 1`,
+		`latency_seconds_count{registry="reg"} 1`,
+		`# TYPE requests_total counter`,
+		`requests_total{registry="reg"} 2`,
+		``,
+	})
+}
+
+func TestPrometheusReporterNameCollision(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewGauge("a_b", func() float64 { return 1 })
+	reg.NewGauge("a.b", func() float64 { return 2 })
+	other := NewRegistry("other")
+	other.NewGauge("a.b", func() float64 { return 3 })
+
+	r := NewPrometheusReporter()
+	for _, registry := range []*Registry{reg, other} {
+		if err := registry.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	expectPromLines(t, buf.String(), []string{
+		`# TYPE a_b gauge`,
+		`a_b{registry="other"} 3`,
+		`a_b{registry="reg"} 2`,
+		``,
+	})
+}
+
+func TestPrometheusReporterChangedBuckets(t *testing.T) {
+	r := NewPrometheusReporter()
+	for _, bound := range []float64{1, 2} {
+		reg := NewRegistry("reg")
+		reg.NewBucketedTimer("latency", Seconds, []float64{bound}).Update(time.Second)
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	r.WritePrometheus(&buf)
+	expectPromLines(t, buf.String(), []string{
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{registry="reg",le="2"} 1`,
+		`latency_seconds_bucket{registry="reg",le="+Inf"} 1`,
+		`latency_seconds_sum{registry="reg"} 1`,
+		`latency_seconds_count{registry="reg"} 1`,
+		``,
+	})
+}
+
+// expectPromLines checks that each line of the exposition starts with
+// the respective expected prefix.
+func expectPromLines(t *testing.T, body string, expected []string) {
+	t.Helper()
+	lines := strings.Split(body, "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines: %d (%d expected)\n%s", len(lines), len(expected), body)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("wrong line: %q (%q expected)", line, expected[i])
+		}
+	}
+}
+
+func TestAcceptsOpenMetrics(t *testing.T) {
+	tests := map[string]bool{
+		"":                             false,
+		"text/plain":                   false,
+		"application/openmetrics-text": true,
+		"text/plain, application/openmetrics-text; q=0.3": true,
+		"application/openmetrics-text; q=0":               false,
+	}
+	for accept, expected := range tests {
+		if res := acceptsOpenMetrics(accept); res != expected {
+			t.Errorf("wrong result for %q: %v (%v expected)", accept, res, expected)
+		}
+	}
+}
+
+func TestPromName(t *testing.T) {
+	tests := []struct {
+		name, unit string
+		counter    bool
+		expected   string
+	}{
+		{"http.server.requests", "", false, "http_server_requests"},
+		{"2xx-responses", "", true, "_2xx_responses"},
+		{"jobs_total", "", true, "jobs"},
+		{"latency", "seconds", false, "latency_seconds"},
+		{"latency_seconds", "seconds", false, "latency_seconds"},
+	}
+	for _, test := range tests {
+		if res := promName(test.name, test.unit, test.counter); res != test.expected {
+			t.Errorf("wrong name for %q: %s (%s expected)", test.name, res, test.expected)
+		}
+	}
+}
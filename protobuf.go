@@ -0,0 +1,105 @@
+package quant
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Protocol buffer wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// protoBuffer is a minimal protocol buffer encoder. It only supports
+// the field types needed to encode OTLP messages.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) bytes() []byte {
+	return b.buf
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	b.buf = binary.AppendUvarint(b.buf, v)
+}
+
+func (b *protoBuffer) uint64Field(field int, v uint64) {
+	if v != 0 {
+		b.tag(field, protoVarint)
+		b.varint(v)
+	}
+}
+
+func (b *protoBuffer) boolField(field int, v bool) {
+	if v {
+		b.tag(field, protoVarint)
+		b.varint(1)
+	}
+}
+
+func (b *protoBuffer) fixed64Field(field int, v uint64) {
+	if v != 0 {
+		b.tag(field, protoFixed64)
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, v)
+	}
+}
+
+// doubleField encodes a double field. In contrast to the other field
+// types zero values are encoded as well, which is needed for fields in
+// a oneof and for optional fields.
+func (b *protoBuffer) doubleField(field int, v float64) {
+	b.tag(field, protoFixed64)
+	b.buf = binary.LittleEndian.AppendUint64(b.buf, math.Float64bits(v))
+}
+
+// sfixed64Field encodes a sfixed64 field. Like doubleField zero values
+// are encoded as well.
+func (b *protoBuffer) sfixed64Field(field int, v int64) {
+	b.tag(field, protoFixed64)
+	b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(v))
+}
+
+func (b *protoBuffer) stringField(field int, s string) {
+	if s != "" {
+		b.tag(field, protoBytes)
+		b.varint(uint64(len(s)))
+		b.buf = append(b.buf, s...)
+	}
+}
+
+// messageField encodes a nested message, which is written by the given
+// function into a separate buffer.
+func (b *protoBuffer) messageField(field int, msg func(*protoBuffer)) {
+	var nested protoBuffer
+	msg(&nested)
+	b.tag(field, protoBytes)
+	b.varint(uint64(len(nested.buf)))
+	b.buf = append(b.buf, nested.buf...)
+}
+
+func (b *protoBuffer) packedFixed64Field(field int, vs []uint64) {
+	if len(vs) != 0 {
+		b.tag(field, protoBytes)
+		b.varint(uint64(8 * len(vs)))
+		for _, v := range vs {
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, v)
+		}
+	}
+}
+
+func (b *protoBuffer) packedDoubleField(field int, vs []float64) {
+	if len(vs) != 0 {
+		b.tag(field, protoBytes)
+		b.varint(uint64(8 * len(vs)))
+		for _, v := range vs {
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, math.Float64bits(v))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package quant
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 // Registry represents a collection of metrics. Each metric
@@ -15,8 +16,16 @@ type Registry struct {
 	mtx         sync.RWMutex
 	metricNames map[string]struct{}
 	counters    map[string]*Counter
+	monotonics  map[string]*MonotonicCounter
+	floats      map[string]*FloatCounter
 	gauges      map[string]*Gauge
+	settables   map[string]*SettableGauge
+	intGauges   map[string]*IntGauge
+	gaugeSets   []*GaugeSet
 	timers      map[string]*Timer
+	histograms  map[string]*Histogram
+	collectors  []func()
+	deltas      *deltaTracker
 }
 
 // NewRegistry creates a new registry with the specified name.
@@ -26,8 +35,14 @@ func NewRegistry(name string) *Registry {
 		name:        name,
 		metricNames: make(map[string]struct{}),
 		counters:    make(map[string]*Counter),
+		monotonics:  make(map[string]*MonotonicCounter),
+		floats:      make(map[string]*FloatCounter),
 		gauges:      make(map[string]*Gauge),
+		settables:   make(map[string]*SettableGauge),
+		intGauges:   make(map[string]*IntGauge),
 		timers:      make(map[string]*Timer),
+		histograms:  make(map[string]*Histogram),
+		deltas:      newDeltaTracker(),
 	}
 }
 
@@ -49,13 +64,10 @@ func (r *Registry) NewCounterWithUnit(name, unit string) *Counter {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if _, exists := r.metricNames[name]; exists {
-		panic(fmt.Errorf("metric already exists: %s", name))
-	}
+	r.addName(name)
 
 	counter := newCounter(name, unit)
 	r.counters[name] = counter
-	r.metricNames[name] = struct{}{}
 	return counter
 }
 
@@ -68,6 +80,82 @@ func (r *Registry) Counter(name string) *Counter {
 	return counter
 }
 
+// NewMonotonicCounter adds a new monotonic counter metric to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewMonotonicCounter(name string) *MonotonicCounter {
+	return r.NewMonotonicCounterWithUnit(name, "")
+}
+
+// NewMonotonicCounterWithUnit adds a new monotonic counter metric with
+// the specified unit to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewMonotonicCounterWithUnit(name, unit string) *MonotonicCounter {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	counter := newMonotonicCounter(name, unit)
+	r.monotonics[name] = counter
+	return counter
+}
+
+// MonotonicCounter retrieves the monotonic counter with the given name.
+// If no such counter exists nil will be returned.
+func (r *Registry) MonotonicCounter(name string) *MonotonicCounter {
+	r.mtx.RLock()
+	counter := r.monotonics[name]
+	r.mtx.RUnlock()
+	return counter
+}
+
+// NewFloatCounter adds a new float counter metric to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewFloatCounter(name string) *FloatCounter {
+	return r.NewFloatCounterWithUnit(name, "")
+}
+
+// NewFloatCounterWithUnit adds a new float counter metric with the
+// specified unit to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewFloatCounterWithUnit(name, unit string) *FloatCounter {
+	return r.newFloatCounter(name, unit, false)
+}
+
+// NewMonotonicFloatCounter adds a new float counter metric, which can
+// only be increased, to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewMonotonicFloatCounter(name string) *FloatCounter {
+	return r.NewMonotonicFloatCounterWithUnit(name, "")
+}
+
+// NewMonotonicFloatCounterWithUnit adds a new float counter metric with
+// the specified unit, which can only be increased, to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewMonotonicFloatCounterWithUnit(name, unit string) *FloatCounter {
+	return r.newFloatCounter(name, unit, true)
+}
+
+func (r *Registry) newFloatCounter(name, unit string, monotonic bool) *FloatCounter {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	counter := newFloatCounter(name, unit, monotonic)
+	r.floats[name] = counter
+	return counter
+}
+
+// FloatCounter retrieves the float counter with the given name. If no
+// such counter exists nil will be returned.
+func (r *Registry) FloatCounter(name string) *FloatCounter {
+	r.mtx.RLock()
+	counter := r.floats[name]
+	r.mtx.RUnlock()
+	return counter
+}
+
 // NewGauge adds a new gauge metric to the registry.
 // If the given name already exists this function will panic.
 func (r *Registry) NewGauge(name string, reader GaugeReader) *Gauge {
@@ -81,13 +169,10 @@ func (r *Registry) NewGaugeWithUnit(name, unit string, reader GaugeReader) *Gaug
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if _, exists := r.metricNames[name]; exists {
-		panic(fmt.Errorf("metric already exists: %s", name))
-	}
+	r.addName(name)
 
 	gauge := newGauge(name, unit, reader)
 	r.gauges[name] = gauge
-	r.metricNames[name] = struct{}{}
 	return gauge
 }
 
@@ -100,6 +185,102 @@ func (r *Registry) Gauge(name string) *Gauge {
 	return gauge
 }
 
+// NewSettableGauge adds a new settable gauge metric to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewSettableGauge(name string) *SettableGauge {
+	return r.NewSettableGaugeWithUnit(name, "")
+}
+
+// NewSettableGaugeWithUnit adds a new settable gauge metric with the
+// specified unit to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewSettableGaugeWithUnit(name, unit string) *SettableGauge {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	gauge := newSettableGauge(name, unit)
+	r.settables[name] = gauge
+	return gauge
+}
+
+// SettableGauge retrieves the settable gauge with the given name. If no
+// such gauge exists nil will be returned.
+func (r *Registry) SettableGauge(name string) *SettableGauge {
+	r.mtx.RLock()
+	gauge := r.settables[name]
+	r.mtx.RUnlock()
+	return gauge
+}
+
+// NewIntGauge adds a new int64 gauge metric to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewIntGauge(name string, reader IntGaugeReader) *IntGauge {
+	return r.NewIntGaugeWithUnit(name, "", reader)
+}
+
+// NewIntGaugeWithUnit adds a new int64 gauge metric with the specified
+// unit to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewIntGaugeWithUnit(name, unit string, reader IntGaugeReader) *IntGauge {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	gauge := newIntGauge(name, unit, reader)
+	r.intGauges[name] = gauge
+	return gauge
+}
+
+// IntGauge retrieves the int64 gauge with the given name. If no such
+// gauge exists nil will be returned.
+func (r *Registry) IntGauge(name string) *IntGauge {
+	r.mtx.RLock()
+	gauge := r.intGauges[name]
+	r.mtx.RUnlock()
+	return gauge
+}
+
+// NewGaugeSet adds a new group of gauge metrics with the given names
+// to the registry. The values of all gauges are read by a single call
+// of reader.
+// If one of the given names already exists or is given more than once
+// this function will panic.
+func (r *Registry) NewGaugeSet(reader GaugeSetReader, names ...string) *GaugeSet {
+	units := make(map[string]string, len(names))
+	for _, name := range names {
+		if _, exists := units[name]; exists {
+			panic(fmt.Errorf("metric already exists: %s", name))
+		}
+		units[name] = ""
+	}
+	return r.NewGaugeSetWithUnits(reader, units)
+}
+
+// NewGaugeSetWithUnits adds a new group of gauge metrics to the registry.
+// The units map is keyed by the gauge names and contains the respective
+// gauge units. The values of all gauges are read by a single call of reader.
+// If one of the given names already exists this function will panic.
+func (r *Registry) NewGaugeSetWithUnits(reader GaugeSetReader, units map[string]string) *GaugeSet {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	set := newGaugeSet(units, reader)
+	for _, name := range set.names {
+		if _, exists := r.metricNames[name]; exists {
+			panic(fmt.Errorf("metric already exists: %s", name))
+		}
+	}
+	for _, name := range set.names {
+		r.addName(name)
+	}
+
+	r.gaugeSets = append(r.gaugeSets, set)
+	return set
+}
+
 // NewTimer adds a new timer metric with the specified unit
 // to the registry.
 // If the given name already exists this function will panic.
@@ -107,13 +288,74 @@ func (r *Registry) NewTimer(name string, unit TimeUnit) *Timer {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if _, exists := r.metricNames[name]; exists {
-		panic(fmt.Errorf("metric already exists: %s", name))
-	}
+	r.addName(name)
 
 	timer := newTimer(name, unit)
 	r.timers[name] = timer
-	r.metricNames[name] = struct{}{}
+	return timer
+}
+
+// NewSketchTimer adds a new timer metric to the registry, which
+// estimates quantiles with a mergeable quantile sketch (DDSketch). The
+// quantiles of its snapshots have a relative error of at most the given
+// accuracy (0 < relativeAccuracy < 1), e.g. 0.01 for 1%.
+// If the given name already exists this function will panic.
+func (r *Registry) NewSketchTimer(name string, unit TimeUnit, relativeAccuracy float64) *Timer {
+	checkRelativeAccuracy(relativeAccuracy)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	timer := newSketchTimer(name, unit, relativeAccuracy)
+	r.timers[name] = timer
+	return timer
+}
+
+// NewHDRTimer adds a new timer metric to the registry, which records its
+// durations into an HDR histogram. Recording does not acquire any locks
+// and the counts of the histogram buckets are exact. The buckets keep the
+// given number of significant decimal digits (1 to 5) for all durations
+// up to the highest trackable duration. Larger durations are recorded as
+// the highest trackable duration.
+// If the given name already exists this function will panic.
+func (r *Registry) NewHDRTimer(name string, unit TimeUnit, highest time.Duration, significantDigits int) *Timer {
+	if significantDigits < 1 || significantDigits > 5 {
+		panic(fmt.Errorf("invalid number of significant digits: %d", significantDigits))
+	}
+	if highest < 2 {
+		panic(fmt.Errorf("invalid highest trackable duration: %s", highest))
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	timer := newHDRTimer(name, unit, highest, significantDigits)
+	r.timers[name] = timer
+	return timer
+}
+
+// NewBucketedTimer adds a new timer metric to the registry, which
+// additionally counts its durations in buckets with the given upper
+// bounds (in the unit of the timer), e.g. created by ExponentialBuckets
+// or LinearBuckets. The bounds must be strictly increasing. A bucket for
+// all durations greater than the highest bound is added implicitly. The
+// snapshots provide the bucket counts (see TimerSnapshot.Buckets) in
+// addition to the statistics every timer provides.
+// If the given name already exists this function will panic.
+func (r *Registry) NewBucketedTimer(name string, unit TimeUnit, buckets []float64) *Timer {
+	bounds := checkBuckets(buckets)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	timer := newBucketedTimer(name, unit, bounds)
+	r.timers[name] = timer
 	return timer
 }
 
@@ -126,6 +368,86 @@ func (r *Registry) Timer(name string) *Timer {
 	return timer
 }
 
+// NewHistogram adds a new histogram metric to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewHistogram(name string) *Histogram {
+	return r.NewHistogramWithUnit(name, "")
+}
+
+// NewHistogramWithUnit adds a new histogram metric with the specified
+// unit to the registry.
+// If the given name already exists this function will panic.
+func (r *Registry) NewHistogramWithUnit(name, unit string) *Histogram {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	histogram := newHistogram(name, unit)
+	r.histograms[name] = histogram
+	return histogram
+}
+
+// NewSketchHistogram adds a new histogram metric to the registry, which
+// estimates quantiles with a mergeable quantile sketch (DDSketch). The
+// quantiles of its snapshots have a relative error of at most the given
+// accuracy (0 < relativeAccuracy < 1), e.g. 0.01 for 1%.
+// If the given name already exists this function will panic.
+func (r *Registry) NewSketchHistogram(name string, relativeAccuracy float64) *Histogram {
+	return r.NewSketchHistogramWithUnit(name, "", relativeAccuracy)
+}
+
+// NewSketchHistogramWithUnit adds a new histogram metric with the
+// specified unit to the registry, which estimates quantiles with a
+// mergeable quantile sketch (see NewSketchHistogram).
+// If the given name already exists this function will panic.
+func (r *Registry) NewSketchHistogramWithUnit(name, unit string, relativeAccuracy float64) *Histogram {
+	checkRelativeAccuracy(relativeAccuracy)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	histogram := newSketchHistogram(name, unit, relativeAccuracy)
+	r.histograms[name] = histogram
+	return histogram
+}
+
+// NewBucketedHistogram adds a new histogram metric to the registry,
+// which additionally counts its values in buckets with the given upper
+// bounds (see NewBucketedTimer).
+// If the given name already exists this function will panic.
+func (r *Registry) NewBucketedHistogram(name string, buckets []float64) *Histogram {
+	return r.NewBucketedHistogramWithUnit(name, "", buckets)
+}
+
+// NewBucketedHistogramWithUnit adds a new histogram metric with the
+// specified unit to the registry, which additionally counts its values
+// in buckets with the given upper bounds (see NewBucketedTimer).
+// If the given name already exists this function will panic.
+func (r *Registry) NewBucketedHistogramWithUnit(name, unit string, buckets []float64) *Histogram {
+	bounds := checkBuckets(buckets)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.addName(name)
+
+	histogram := newBucketedHistogram(name, unit, bounds)
+	r.histograms[name] = histogram
+	return histogram
+}
+
+// Histogram retrieves the histogram with the given name. If no such
+// histogram exists nil will be returned.
+func (r *Registry) Histogram(name string) *Histogram {
+	r.mtx.RLock()
+	histogram := r.histograms[name]
+	r.mtx.RUnlock()
+	return histogram
+}
+
 // Contains checks if a given metric name exists in this registry.
 func (r *Registry) Contains(name string) bool {
 	r.mtx.RLock()
@@ -137,22 +459,48 @@ func (r *Registry) Contains(name string) bool {
 // Report writes the snapshots of all registered metrics to the
 // given reporters. If one reporter returns an error during execution
 // this error will be returned without executing the followwing reporters.
+//
+// The registry remembers the counter values reported to each reporter
+// to provide the deltas since the previous report (see CounterSnapshot.Delta).
+// If a reporter fails to report the counters, the deltas are carried over
+// to the next report. Use Forget to release this state for reporters that
+// are not used anymore.
+//
+// Reporters are identified by their value, so they must be long-lived.
+// A reporter which is created for each report, e.g. with
+// r.Report(FilterReporter(reporter, match)), never sees the deltas of a
+// previous report, i.e. its deltas equal the counter values, and its
+// state is kept until Forget is called with the same value. Create such
+// reporters once and pass the same value to every report.
 func (r *Registry) Report(reporters ...Reporter) error {
 	if len(reporters) == 0 {
 		return nil
 	}
 
 	r.mtx.RLock()
-	counters := r.counterSnapshots()
-	gauges := r.gaugeSnapshots()
+	collectors := r.collectors
+	r.mtx.RUnlock()
+	for _, collect := range collectors {
+		collect()
+	}
+
+	now := time.Now()
+	r.mtx.RLock()
+	counters := r.counterSnapshots(now)
+	gaugeReaders, gaugeSets := r.gaugeMetrics()
 	timers := r.timerSnapshots()
+	histograms := r.histogramSnapshots()
 	r.mtx.RUnlock()
 
+	// gauge readers are called without holding the registry lock
+	gauges := gaugeSnapshots(gaugeReaders, gaugeSets)
+
 	for _, reporter := range reporters {
 		if len(counters) != 0 {
-			if err := reporter.ReportCounters(r.name, counters); err != nil {
+			if err := reporter.ReportCounters(r.name, r.deltas.track(reporter, counters)); err != nil {
 				return err
 			}
+			r.deltas.commit(reporter, now, counters)
 		}
 		if len(gauges) != 0 {
 			if err := reporter.ReportGauges(r.name, gauges); err != nil {
@@ -164,26 +512,221 @@ func (r *Registry) Report(reporters ...Reporter) error {
 				return err
 			}
 		}
+		if hr, ok := reporter.(HistogramReporter); ok && len(histograms) != 0 {
+			if err := hr.ReportHistograms(r.name, histograms); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (r *Registry) counterSnapshots() []*CounterSnapshot {
-	snapshots := make([]*CounterSnapshot, len(r.counters))
-	idx := 0
+// Forget releases the counter values the registry remembers for
+// the given reporter. The next report to this reporter will start
+// with fresh counter deltas.
+func (r *Registry) Forget(reporter Reporter) {
+	r.deltas.forget(reporter)
+}
+
+// addCollector adds a function which is called at the beginning of
+// each report, before any snapshot is taken. Collectors are used to
+// update several metrics from a single sample.
+func (r *Registry) addCollector(collect func()) {
+	r.mtx.Lock()
+	r.collectors = append(r.collectors, collect)
+	r.mtx.Unlock()
+}
+
+// counterOrNew retrieves the counter with the given name or adds
+// a new one if it does not exist yet. If the name belongs to another
+// metric type this function will panic.
+func (r *Registry) counterOrNew(name string) *Counter {
+	r.mtx.RLock()
+	counter := r.counters[name]
+	r.mtx.RUnlock()
+	if counter != nil {
+		return counter
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	counter = r.counters[name]
+	if counter == nil {
+		r.addName(name)
+		counter = newCounter(name, "")
+		r.counters[name] = counter
+	}
+	return counter
+}
+
+// counterOrNewIfFree works like counterOrNew, but returns nil instead
+// of panicking if the name belongs to another metric type.
+func (r *Registry) counterOrNewIfFree(name string) *Counter {
+	r.mtx.RLock()
+	counter := r.counters[name]
+	r.mtx.RUnlock()
+	if counter != nil {
+		return counter
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	counter = r.counters[name]
+	if counter == nil {
+		if _, exists := r.metricNames[name]; exists {
+			return nil
+		}
+		r.addName(name)
+		counter = newCounter(name, "")
+		r.counters[name] = counter
+	}
+	return counter
+}
+
+// timerOrNewIfFree retrieves the timer with the given name or adds a
+// new one if the name does not exist yet. If the name belongs to another
+// metric type nil will be returned.
+func (r *Registry) timerOrNewIfFree(name string, unit TimeUnit) *Timer {
+	r.mtx.RLock()
+	timer := r.timers[name]
+	r.mtx.RUnlock()
+	if timer != nil {
+		return timer
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	timer = r.timers[name]
+	if timer == nil {
+		if _, exists := r.metricNames[name]; exists {
+			return nil
+		}
+		r.addName(name)
+		timer = newTimer(name, unit)
+		r.timers[name] = timer
+	}
+	return timer
+}
+
+// gaugeOrNewIfFree retrieves the gauge with the given name or adds a
+// new one with the given reader if the name does not exist yet. If the
+// name belongs to another metric type nil will be returned.
+func (r *Registry) gaugeOrNewIfFree(name string, reader GaugeReader) *Gauge {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	gauge := r.gauges[name]
+	if gauge == nil {
+		if _, exists := r.metricNames[name]; exists {
+			return nil
+		}
+		r.addName(name)
+		gauge = newGauge(name, "", reader)
+		r.gauges[name] = gauge
+	}
+	return gauge
+}
+
+// intGaugeOrNewIfFree works like gaugeOrNewIfFree for int64 gauges.
+func (r *Registry) intGaugeOrNewIfFree(name string, reader IntGaugeReader) *IntGauge {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	gauge := r.intGauges[name]
+	if gauge == nil {
+		if _, exists := r.metricNames[name]; exists {
+			return nil
+		}
+		r.addName(name)
+		gauge = newIntGauge(name, "", reader)
+		r.intGauges[name] = gauge
+	}
+	return gauge
+}
+
+// histogramOrNew retrieves the histogram with the given name or adds
+// a new one if it does not exist yet. If the name belongs to another
+// metric type this function will panic.
+func (r *Registry) histogramOrNew(name, unit string) *Histogram {
+	r.mtx.RLock()
+	histogram := r.histograms[name]
+	r.mtx.RUnlock()
+	if histogram != nil {
+		return histogram
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	histogram = r.histograms[name]
+	if histogram == nil {
+		r.addName(name)
+		histogram = newHistogram(name, unit)
+		r.histograms[name] = histogram
+	}
+	return histogram
+}
+
+func checkRelativeAccuracy(accuracy float64) {
+	if !(accuracy > 0 && accuracy < 1) {
+		panic(fmt.Errorf("invalid relative accuracy: %g", accuracy))
+	}
+}
+
+// addName registers a new metric name. The caller must hold the
+// write lock. If the name already exists this function will panic.
+func (r *Registry) addName(name string) {
+	if _, exists := r.metricNames[name]; exists {
+		panic(fmt.Errorf("metric already exists: %s", name))
+	}
+	r.metricNames[name] = struct{}{}
+}
+
+func (r *Registry) counterSnapshots(now time.Time) []*CounterSnapshot {
+	snapshots := make([]*CounterSnapshot, 0, len(r.counters)+len(r.monotonics)+len(r.floats))
 	for _, counter := range r.counters {
-		snapshots[idx] = counter.snapshot()
-		idx++
+		snapshots = append(snapshots, counter.snapshot())
+	}
+	for _, counter := range r.monotonics {
+		snapshots = append(snapshots, counter.snapshot())
+	}
+	for _, counter := range r.floats {
+		snapshots = append(snapshots, counter.snapshot())
+	}
+	for _, snap := range snapshots {
+		snap.time = now
 	}
 	return snapshots
 }
 
-func (r *Registry) gaugeSnapshots() []*GaugeSnapshot {
-	snapshots := make([]*GaugeSnapshot, len(r.gauges))
-	idx := 0
+type gaugeSnapshotter interface {
+	snapshot() *GaugeSnapshot
+}
+
+func (r *Registry) gaugeMetrics() ([]gaugeSnapshotter, []*GaugeSet) {
+	gauges := make([]gaugeSnapshotter, 0, len(r.gauges)+len(r.settables)+len(r.intGauges))
 	for _, gauge := range r.gauges {
-		snapshots[idx] = gauge.snapshot()
-		idx++
+		gauges = append(gauges, gauge)
+	}
+	for _, gauge := range r.settables {
+		gauges = append(gauges, gauge)
+	}
+	for _, gauge := range r.intGauges {
+		gauges = append(gauges, gauge)
+	}
+	return gauges, append([]*GaugeSet(nil), r.gaugeSets...)
+}
+
+func gaugeSnapshots(gauges []gaugeSnapshotter, sets []*GaugeSet) []*GaugeSnapshot {
+	snapshots := make([]*GaugeSnapshot, 0, len(gauges)+len(sets))
+	for _, gauge := range gauges {
+		snapshots = append(snapshots, gauge.snapshot())
+	}
+	for _, set := range sets {
+		snapshots = append(snapshots, set.snapshots()...)
 	}
 	return snapshots
 }
@@ -197,3 +740,13 @@ func (r *Registry) timerSnapshots() []*TimerSnapshot {
 	}
 	return snapshots
 }
+
+func (r *Registry) histogramSnapshots() []*HistogramSnapshot {
+	snapshots := make([]*HistogramSnapshot, len(r.histograms))
+	idx := 0
+	for _, histogram := range r.histograms {
+		snapshots[idx] = histogram.snapshot()
+		idx++
+	}
+	return snapshots
+}
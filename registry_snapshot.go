@@ -0,0 +1,211 @@
+package quant
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// RegistrySnapshot aggregates the snapshots of several registries into a
+// single view, e.g. in a sidecar which combines the metrics of worker
+// processes or shards before forwarding them to the actual reporters.
+// Snapshots with the same name are merged with the Merge method of the
+// respective snapshot type.
+//
+// A RegistrySnapshot implements Reporter and HistogramReporter, so it can
+// be passed to Registry.Report directly, or fed with decoded snapshots of
+// remote processes. Each source should be reported once per interval,
+// since counter values are summed up. Report forwards the aggregated
+// snapshots and starts a new interval.
+type RegistrySnapshot struct {
+	name string
+
+	mtx        sync.Mutex
+	counters   map[string]*CounterSnapshot
+	gauges     map[string]*GaugeSnapshot
+	timers     map[string]*TimerSnapshot
+	histograms map[string]*HistogramSnapshot
+}
+
+// NewRegistrySnapshot creates an empty registry snapshot. The given name
+// is used as the registry name when the snapshot is reported.
+func NewRegistrySnapshot(name string) *RegistrySnapshot {
+	return &RegistrySnapshot{
+		name:       name,
+		counters:   make(map[string]*CounterSnapshot),
+		gauges:     make(map[string]*GaugeSnapshot),
+		timers:     make(map[string]*TimerSnapshot),
+		histograms: make(map[string]*HistogramSnapshot),
+	}
+}
+
+// Name returns the registry name of the snapshot.
+func (s *RegistrySnapshot) Name() string {
+	return s.name
+}
+
+// Counters returns the aggregated counter snapshots sorted by name.
+func (s *RegistrySnapshot) Counters() []*CounterSnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return sortedSnapshots(s.counters)
+}
+
+// Gauges returns the aggregated gauge snapshots sorted by name.
+func (s *RegistrySnapshot) Gauges() []*GaugeSnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return sortedSnapshots(s.gauges)
+}
+
+// Timers returns the aggregated timer snapshots sorted by name.
+func (s *RegistrySnapshot) Timers() []*TimerSnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return sortedSnapshots(s.timers)
+}
+
+// Histograms returns the aggregated histogram snapshots sorted by name.
+func (s *RegistrySnapshot) Histograms() []*HistogramSnapshot {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return sortedSnapshots(s.histograms)
+}
+
+// Merge merges all snapshots of other into s. Merging a registry
+// snapshot into itself is a no-op.
+func (s *RegistrySnapshot) Merge(other *RegistrySnapshot) error {
+	if other == s {
+		return nil
+	}
+
+	counters, gauges := other.Counters(), other.Gauges()
+	timers, histograms := other.Timers(), other.Histograms()
+	return errors.Join(
+		s.ReportCounters(other.name, counters),
+		s.ReportGauges(other.name, gauges),
+		s.ReportTimers(other.name, timers),
+		s.ReportHistograms(other.name, histograms),
+	)
+}
+
+// ReportCounters merges the counter snapshots. The registry name is
+// ignored.
+func (s *RegistrySnapshot) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var errs []error
+	for _, c := range counters {
+		if agg, has := s.counters[c.Name()]; has {
+			errs = append(errs, agg.Merge(c))
+		} else {
+			snap := *c
+			s.counters[c.Name()] = &snap
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReportGauges merges the gauge snapshots. The registry name is ignored.
+func (s *RegistrySnapshot) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var errs []error
+	for _, g := range gauges {
+		if agg, has := s.gauges[g.Name()]; has {
+			errs = append(errs, agg.Merge(g))
+		} else {
+			snap := *g
+			s.gauges[g.Name()] = &snap
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReportTimers merges the timer snapshots. The registry name is ignored.
+func (s *RegistrySnapshot) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var errs []error
+	for _, t := range timers {
+		agg, has := s.timers[t.Name()]
+		if !has {
+			agg = newTimerSnaphot(t.name, t.unit)
+			s.timers[t.Name()] = agg
+		}
+		errs = append(errs, agg.Merge(t))
+	}
+	return errors.Join(errs...)
+}
+
+// ReportHistograms merges the histogram snapshots. The registry name is
+// ignored.
+func (s *RegistrySnapshot) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var errs []error
+	for _, h := range histograms {
+		agg, has := s.histograms[h.Name()]
+		if !has {
+			agg = newHistogramSnapshot(h.name, h.unit)
+			s.histograms[h.Name()] = agg
+		}
+		errs = append(errs, agg.Merge(h))
+	}
+	return errors.Join(errs...)
+}
+
+// Report writes the aggregated snapshots to the given reporters and
+// resets the registry snapshot. Histograms are only written to reporters
+// which implement HistogramReporter.
+func (s *RegistrySnapshot) Report(reporters ...Reporter) error {
+	s.mtx.Lock()
+	counters := sortedSnapshots(s.counters)
+	gauges := sortedSnapshots(s.gauges)
+	timers := sortedSnapshots(s.timers)
+	histograms := sortedSnapshots(s.histograms)
+	s.counters = make(map[string]*CounterSnapshot)
+	s.gauges = make(map[string]*GaugeSnapshot)
+	s.timers = make(map[string]*TimerSnapshot)
+	s.histograms = make(map[string]*HistogramSnapshot)
+	s.mtx.Unlock()
+
+	for _, reporter := range reporters {
+		if len(counters) != 0 {
+			if err := reporter.ReportCounters(s.name, counters); err != nil {
+				return err
+			}
+		}
+		if len(gauges) != 0 {
+			if err := reporter.ReportGauges(s.name, gauges); err != nil {
+				return err
+			}
+		}
+		if len(timers) != 0 {
+			if err := reporter.ReportTimers(s.name, timers); err != nil {
+				return err
+			}
+		}
+		if hr, ok := reporter.(HistogramReporter); ok && len(histograms) != 0 {
+			if err := hr.ReportHistograms(s.name, histograms); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedSnapshots[S interface{ Name() string }](snaps map[string]S) []S {
+	res := make([]S, 0, len(snaps))
+	for _, s := range snaps {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name() < res[j].Name()
+	})
+	return res
+}
@@ -0,0 +1,116 @@
+package quant
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterSnapshotMerge(t *testing.T) {
+	t1, t2 := time.Unix(100, 0), time.Unix(200, 0)
+	c := NewCounterSnapshot("requests", "", 10, true).WithDelta(4, t2)
+	c.time = t2
+	other := NewFloatCounterSnapshot("requests", "", 2.5, false).WithDelta(1.5, t1)
+	other.time = t1
+
+	if err := c.Merge(other); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	switch {
+	case !c.IsFloat() || c.Monotonic():
+		t.Errorf("wrong counter type: float=%v, monotonic=%v", c.IsFloat(), c.Monotonic())
+	case c.FloatValue() != 12.5 || c.Value() != 12:
+		t.Errorf("wrong value: %v (12.5 expected)", c.FloatValue())
+	case c.FloatDelta() != 5.5:
+		t.Errorf("wrong delta: %v (5.5 expected)", c.FloatDelta())
+	case !c.Time().Equal(t2) || !c.PreviousTime().Equal(t1):
+		t.Errorf("wrong times: %v, %v", c.Time(), c.PreviousTime())
+	}
+
+	if err := c.Merge(NewCounterSnapshot("requests", "ms", 1, false)); err == nil {
+		t.Error("merge of different units succeeded")
+	}
+}
+
+func TestTimerSnapshotMerge(t *testing.T) {
+	values := make([]float64, 0, 3*reservoirSize)
+	for i := 0; i < cap(values); i++ {
+		values = append(values, float64(i))
+	}
+
+	s := NewTimerSnapshot("latency", "ms", values[:reservoirSize]...)
+	other := NewTimerSnapshot("latency", "ms", values[reservoirSize:]...)
+	other.exemplar = &Exemplar{TraceID: "abc", Value: 5, Time: time.Now()}
+	if err := s.Merge(other); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+
+	expected := NewTimerSnapshot("latency", "ms", values...)
+	switch {
+	case s.Count() != expected.Count():
+		t.Errorf("wrong count: %d (%d expected)", s.Count(), expected.Count())
+	case s.Minimum() != 0 || s.Maximum() != float64(len(values)-1):
+		t.Errorf("wrong range: %v, %v", s.Minimum(), s.Maximum())
+	case s.Average() != expected.Average():
+		t.Errorf("wrong average: %v (%v expected)", s.Average(), expected.Average())
+	case s.Exemplar() == nil || s.Exemplar().TraceID != "abc":
+		t.Errorf("wrong exemplar: %+v", s.Exemplar())
+	}
+	if median := s.Quantile(0.5); math.Abs(median-expected.Quantile(0.5)) > 0.1*float64(len(values)) {
+		t.Errorf("wrong median: %v (~%v expected)", median, expected.Quantile(0.5))
+	}
+}
+
+func TestRegistrySnapshot(t *testing.T) {
+	agg := NewRegistrySnapshot("workers")
+	for i := 0; i < 3; i++ {
+		reg := NewRegistry("worker")
+		reg.NewCounter("jobs").Add(int64(i + 1))
+		reg.NewIntGauge("inflight", func() int64 { return 2 })
+		reg.NewTimer("latency", Milliseconds).Update(time.Duration(i+1) * time.Millisecond)
+		reg.NewHistogram("size").Observe(float64(i))
+		if err := reg.Report(agg); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	if err := agg.Merge(agg); err != nil {
+		t.Fatalf("unexpected self merge error: %v", err)
+	}
+
+	other := NewRegistrySnapshot("other")
+	other.ReportCounters("", []*CounterSnapshot{NewCounterSnapshot("jobs", "", 4, false)})
+	if err := agg.Merge(other); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+
+	rec := &recordingReporter{}
+	var gauges []*GaugeSnapshot
+	err := agg.Report(&testReporter{
+		reportCounters: rec.ReportCounters,
+		reportGauges: func(_ string, snaps []*GaugeSnapshot) error {
+			gauges = snaps
+			return nil
+		},
+		reportTimers:     rec.ReportTimers,
+		reportHistograms: rec.ReportHistograms,
+	})
+	if err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	switch {
+	case len(rec.counters) != 1 || rec.counters[0].Value() != 10:
+		t.Errorf("wrong counters: %v", rec.counters)
+	case len(gauges) != 1 || !gauges[0].IsInt() || gauges[0].IntValue() != 6:
+		t.Errorf("wrong gauges: %v", gauges)
+	case len(rec.timers) != 1 || rec.timers[0].Count() != 3 || rec.timers[0].Maximum() != 3:
+		t.Errorf("wrong timers: %v", rec.timers)
+	case len(rec.histograms) != 1 || rec.histograms[0].Count() != 3:
+		t.Errorf("wrong histograms: %v", rec.histograms)
+	}
+
+	if len(agg.Counters()) != 0 || len(agg.Timers()) != 0 {
+		t.Error("registry snapshot not reset after report")
+	}
+}
@@ -1,6 +1,8 @@
 package quant
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -10,7 +12,9 @@ func TestRegistry(t *testing.T) {
 
 	c := reg.NewCounter("my-counter")
 	g := reg.NewGauge("my-gauge", func() float64 { return 0 })
+	sg := reg.NewSettableGauge("my-settable-gauge")
 	tm := reg.NewTimer("my-timer", Milliseconds)
+	h := reg.NewHistogram("my-histogram")
 
 	switch {
 	case c == nil:
@@ -26,12 +30,319 @@ func TestRegistry(t *testing.T) {
 		t.Error("wrong gauge in registry")
 	}
 
+	switch {
+	case sg == nil:
+		t.Error("no settable gauge in registry")
+	case sg != reg.SettableGauge("my-settable-gauge"):
+		t.Error("wrong settable gauge in registry")
+	}
+
 	switch {
 	case tm == nil:
 		t.Error("no timer in registry")
 	case tm != reg.Timer("my-timer"):
 		t.Error("wrong timer in registry")
 	}
+
+	switch {
+	case h == nil:
+		t.Error("no histogram in registry")
+	case h != reg.Histogram("my-histogram"):
+		t.Error("wrong histogram in registry")
+	}
+}
+
+func TestRegistryCounterKinds(t *testing.T) {
+	reg := NewRegistry("reg")
+
+	reg.NewCounter("counter").Add(3)
+	reg.NewMonotonicCounter("monotonic").Add(2)
+	reg.NewFloatCounter("float").Add(0.5)
+	reg.NewMonotonicFloatCounter("monotonic-float").Add(1.5)
+
+	if reg.MonotonicCounter("monotonic") == nil {
+		t.Error("no monotonic counter in registry")
+	}
+	if reg.FloatCounter("float") == nil || reg.FloatCounter("monotonic-float") == nil {
+		t.Error("no float counter in registry")
+	}
+
+	reg.Report(&testReporter{
+		reportCounters: func(registryName string, counters []*CounterSnapshot) error {
+			if len(counters) != 4 {
+				t.Fatalf("wrong number of counters: %d (4 expected)", len(counters))
+			}
+			for _, c := range counters {
+				var monotonic, float bool
+				var value float64
+				switch c.Name() {
+				case "counter":
+					value = 3
+				case "monotonic":
+					monotonic, value = true, 2
+				case "float":
+					float, value = true, 0.5
+				case "monotonic-float":
+					monotonic, float, value = true, true, 1.5
+				}
+				if c.Monotonic() != monotonic || c.IsFloat() != float || c.FloatValue() != value {
+					t.Errorf("wrong snapshot for %s: monotonic=%v, float=%v, value=%f", c.Name(), c.Monotonic(), c.IsFloat(), c.FloatValue())
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func TestRegistryCounterDeltas(t *testing.T) {
+	reg := NewRegistry("reg")
+	c := reg.NewCounter("my-counter")
+	f := reg.NewFloatCounter("my-float-counter")
+
+	var snaps []*CounterSnapshot
+	reporter := &testReporter{
+		reportCounters: func(registryName string, counters []*CounterSnapshot) error {
+			snaps = counters
+			return nil
+		},
+	}
+	findSnapshot := func(name string) *CounterSnapshot {
+		for _, s := range snaps {
+			if s.Name() == name {
+				return s
+			}
+		}
+		t.Fatalf("counter snapshot not found: %s", name)
+		return nil
+	}
+
+	c.Add(5)
+	f.Add(1.5)
+	reg.Report(reporter)
+	first := findSnapshot("my-counter")
+	if first.Delta() != 5 {
+		t.Errorf("wrong first counter delta: %d (5 expected)", first.Delta())
+	}
+	if !first.PreviousTime().IsZero() {
+		t.Errorf("unexpected previous report time: %s", first.PreviousTime())
+	}
+
+	c.Add(3)
+	f.Add(0.25)
+	reg.Report(reporter)
+	second := findSnapshot("my-counter")
+	if second.Value() != 8 || second.Delta() != 3 {
+		t.Errorf("wrong counter value or delta: %d/%d (8/3 expected)", second.Value(), second.Delta())
+	}
+	if !second.PreviousTime().Equal(first.Time()) {
+		t.Errorf("wrong previous report time: %s (%s expected)", second.PreviousTime(), first.Time())
+	}
+	if d := findSnapshot("my-float-counter").FloatDelta(); d != 0.25 {
+		t.Errorf("wrong float counter delta: %f (0.25 expected)", d)
+	}
+
+	// another reporter has its own state
+	other := &testReporter{reportCounters: reporter.reportCounters}
+	reg.Report(other)
+	if d := findSnapshot("my-counter").Delta(); d != 8 {
+		t.Errorf("wrong counter delta for new reporter: %d (8 expected)", d)
+	}
+
+	reg.Forget(reporter)
+	reg.Report(reporter)
+	if d := findSnapshot("my-counter").Delta(); d != 8 {
+		t.Errorf("wrong counter delta after forgetting the reporter: %d (8 expected)", d)
+	}
+}
+
+func TestRegistryCounterDeltasFailedReport(t *testing.T) {
+	reg := NewRegistry("reg")
+	c := reg.NewCounter("my-counter")
+
+	var delta int64
+	fail := true
+	reporter := &testReporter{
+		reportCounters: func(registryName string, counters []*CounterSnapshot) error {
+			delta = counters[0].Delta()
+			if fail {
+				return errors.New("report failed")
+			}
+			return nil
+		},
+	}
+
+	c.Add(5)
+	if err := reg.Report(reporter); err == nil {
+		t.Fatal("no report error")
+	}
+	fail = false
+	c.Add(3)
+	reg.Report(reporter)
+	if delta != 8 {
+		t.Errorf("wrong delta after failed report: %d (8 expected)", delta)
+	}
+	c.Add(1)
+	reg.Report(reporter)
+	if delta != 1 {
+		t.Errorf("wrong delta after successful report: %d (1 expected)", delta)
+	}
+}
+
+func TestRegistryCounterDeltasCombinator(t *testing.T) {
+	reg := NewRegistry("reg")
+	c := reg.NewCounter("my-counter")
+
+	var deltas []int64
+	inner := &testReporter{
+		reportCounters: func(registryName string, counters []*CounterSnapshot) error {
+			deltas = append(deltas, counters[0].Delta())
+			return nil
+		},
+	}
+	match := func(string) bool { return true }
+
+	// a combinator created once keeps its deltas and a single state
+	reporter := FilterReporter(inner, match)
+	for i := 0; i < 3; i++ {
+		c.Add(2)
+		reg.Report(reporter)
+	}
+	if len(reg.deltas.states) != 1 {
+		t.Errorf("wrong number of tracked reporters: %d (1 expected)", len(reg.deltas.states))
+	}
+
+	// a combinator created per report starts from scratch each time and
+	// keeps its state until it is forgotten
+	for i := 0; i < 2; i++ {
+		c.Add(2)
+		perCall := FilterReporter(inner, match)
+		reg.Report(perCall)
+		if len(reg.deltas.states) != 2 {
+			t.Errorf("wrong number of tracked reporters: %d (2 expected)", len(reg.deltas.states))
+		}
+		reg.Forget(perCall)
+	}
+	if expected := []int64{2, 2, 2, 8, 10}; !reflect.DeepEqual(deltas, expected) {
+		t.Errorf("wrong deltas: %v (%v expected)", deltas, expected)
+	}
+	if len(reg.deltas.states) != 1 {
+		t.Errorf("wrong number of tracked reporters after forgetting: %d (1 expected)", len(reg.deltas.states))
+	}
+}
+
+func TestReportingForgetsReporters(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("my-counter").Increment()
+	noop := func() *testReporter {
+		return &testReporter{
+			reportCounters: func(string, []*CounterSnapshot) error { return nil },
+		}
+	}
+	r1, r2 := noop(), noop()
+	reg.Report(r1, r2)
+
+	tracked := func(r Reporter) bool {
+		reg.deltas.mtx.Lock()
+		defer reg.deltas.mtx.Unlock()
+		return reg.deltas.states[r] != nil
+	}
+
+	reporting := StartReporting(time.Hour, r1, r2)
+	reporting.Attach(reg)
+	reporting.Reset(time.Hour, r2)
+	reporting.Reset(time.Hour, r2) // waits until the first reset was applied
+	if tracked(r1) || !tracked(r2) {
+		t.Errorf("wrong tracked reporters after reset: r1=%v, r2=%v (false, true expected)", tracked(r1), tracked(r2))
+	}
+
+	reporting.Stop()
+	if tracked(r2) {
+		t.Error("reporter still tracked after stopping the reporting")
+	}
+}
+
+func TestRegistryGaugeSet(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewGaugeSet(func() map[string]float64 {
+		return map[string]float64{"heap": 1, "stack": 2}
+	}, "heap", "stack")
+
+	if !reg.Contains("heap") || !reg.Contains("stack") {
+		t.Error("gauge set names not in registry")
+	}
+
+	reg.Report(&testReporter{
+		reportGauges: func(registryName string, gauges []*GaugeSnapshot) error {
+			if len(gauges) != 2 {
+				t.Errorf("wrong number of gauges: %d (2 expected)", len(gauges))
+			}
+			return nil
+		},
+	})
+}
+
+func TestRegistryExistingGaugeSetMetric(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Errorf("registry does not panic for existing metrics")
+		}
+	}()
+
+	reg := NewRegistry("reg")
+	reg.NewCounter("m")
+	reg.NewGaugeSet(func() map[string]float64 { return nil }, "n", "m")
+}
+
+func TestRegistryDuplicateGaugeSetName(t *testing.T) {
+	reg := NewRegistry("reg")
+	expectPanic(t, func() { reg.NewGaugeSet(func() map[string]float64 { return nil }, "n", "n") })
+	if reg.Contains("n") {
+		t.Error("name of rejected gauge set in registry")
+	}
+}
+
+func TestRegistryGaugeSetUnits(t *testing.T) {
+	reg := NewRegistry("reg")
+	units := map[string]string{"heap": "B"}
+	reg.NewGaugeSetWithUnits(func() map[string]float64 {
+		return map[string]float64{"heap": 1}
+	}, units)
+	units["heap"] = "kB"
+	units["stack"] = "B"
+
+	reg.Report(&testReporter{
+		reportGauges: func(registryName string, gauges []*GaugeSnapshot) error {
+			if len(gauges) != 1 || gauges[0].Unit() != "B" {
+				t.Errorf("gauge set changed by modifying the units map: %v", gauges)
+			}
+			return nil
+		},
+	})
+}
+
+func TestRegistryHangingGauge(t *testing.T) {
+	reg := NewRegistry("reg")
+	release := make(chan struct{})
+	defer close(release)
+
+	reg.NewGauge("my-gauge", func() float64 {
+		<-release
+		return 0
+	}).SetTimeout(10 * time.Millisecond)
+
+	var err error
+	reg.Report(&testReporter{
+		reportGauges: func(registryName string, gauges []*GaugeSnapshot) error {
+			err = gauges[0].Err()
+			return nil
+		},
+	})
+	if err != ErrReadTimeout {
+		t.Errorf("wrong gauge error: %v (%v expected)", err, ErrReadTimeout)
+	}
+
+	// the registry must not be locked while reading gauges
+	reg.NewCounter("my-counter")
 }
 
 func TestRegistryExistingMetric(t *testing.T) {
@@ -47,9 +358,10 @@ func TestRegistryExistingMetric(t *testing.T) {
 }
 
 type testReporter struct {
-	reportCounters func(string, []*CounterSnapshot) error
-	reportGauges   func(string, []*GaugeSnapshot) error
-	reportTimers   func(string, []*TimerSnapshot) error
+	reportCounters   func(string, []*CounterSnapshot) error
+	reportGauges     func(string, []*GaugeSnapshot) error
+	reportTimers     func(string, []*TimerSnapshot) error
+	reportHistograms func(string, []*HistogramSnapshot) error
 }
 
 func (r *testReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
@@ -64,6 +376,10 @@ func (r *testReporter) ReportTimers(registryName string, timers []*TimerSnapshot
 	return r.reportTimers(registryName, timers)
 }
 
+func (r *testReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	return r.reportHistograms(registryName, histograms)
+}
+
 func TestRegistryReporting(t *testing.T) {
 	reg := NewRegistry("reg")
 
@@ -1,7 +1,7 @@
 package quant
 
 import (
-	"fmt"
+	"os"
 )
 
 // Reporter is an interface that is used by a registry to write
@@ -12,6 +12,13 @@ type Reporter interface {
 	ReportTimers(registryName string, timers []*TimerSnapshot) error
 }
 
+// HistogramReporter is an optional interface a Reporter can implement
+// to receive histogram snapshots. Histograms are not written to reporters
+// which do not implement this interface.
+type HistogramReporter interface {
+	ReportHistograms(registryName string, histograms []*HistogramSnapshot) error
+}
+
 // NullReporter is a Reporter implementation that does nothing. Each function
 // simply returns a nil as an error.
 var NullReporter = nullReporter{}
@@ -30,33 +37,19 @@ func (r nullReporter) ReportTimers(registryName string, timers []*TimerSnapshot)
 	return nil
 }
 
-// StdoutReporter is a Reporter implementation that simply writes the
-// metric snapshots to the standard output.
-var StdoutReporter = stdoutReporter{}
-
-type stdoutReporter struct{}
-
-func (r stdoutReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
-	fmt.Printf("counters of %s\n", registryName)
-	for _, c := range counters {
-		fmt.Printf("  %s: %d%s\n", c.Name(), c.Value(), c.Unit())
-	}
+func (r nullReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
 	return nil
 }
 
-func (r stdoutReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
-	fmt.Printf("gauges of %s\n", registryName)
-	for _, g := range gauges {
-		fmt.Printf("  %s: %f%s\n", g.Name(), g.Value(), g.Unit())
-	}
-	return nil
-}
+// StdoutReporter is a Reporter implementation that simply writes the
+// metric snapshots to the standard output. It is a WriterReporter with
+// a TextFormatter that writes six digits after the decimal point.
+var StdoutReporter = NewWriterReporter(stdout{}, &TextFormatter{Precision: 6})
 
-func (r stdoutReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
-	fmt.Printf("timers of %s\n", registryName)
-	for _, t := range timers {
-		fmt.Printf("  %s: min=%f%s, max=%f%s, avg=%f%s, dev=%f\n",
-			t.Name(), t.Minimum(), t.Unit(), t.Maximum(), t.Unit(), t.Average(), t.Unit(), t.StdDeviation())
-	}
-	return nil
+// stdout writes to the current os.Stdout, so that redirections after
+// the package initialization are respected.
+type stdout struct{}
+
+func (stdout) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
 }
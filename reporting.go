@@ -3,6 +3,7 @@ package quant
 import (
 	"fmt"
 	"log"
+	"reflect"
 	"sync"
 	"time"
 )
@@ -34,7 +35,7 @@ func StartReporting(interval time.Duration, reporters ...Reporter) *Reporting {
 	}
 
 	reporting.wg.Add(1)
-	go reporting.run(&reportingSettings{
+	go reporting.run(reporting.settingsChan, &reportingSettings{
 		interval:  interval,
 		reporters: reporters,
 	})
@@ -62,6 +63,8 @@ func (r *Reporting) Detach(registry *Registry) {
 }
 
 // Reset changes the interval and the reporters for the reporting.
+// The attached registries forget the counter values of the reporters
+// which are not used anymore (see Registry.Forget).
 // Calling this function is allowed on running reportings only. If the
 // reporting was stopped this function will panic.
 func (r *Reporting) Reset(interval time.Duration, reporters ...Reporter) {
@@ -77,7 +80,8 @@ func (r *Reporting) Reset(interval time.Duration, reporters ...Reporter) {
 }
 
 // Stop stops the reporting. Once the reporting is stopped
-// no more metrics are written to the configured reporters.
+// no more metrics are written to the configured reporters and
+// the attached registries forget their counter values.
 // If there is a reporting running, Stop will wait until it
 // is finished.
 func (r *Reporting) Stop() {
@@ -101,13 +105,35 @@ func (r *Reporting) allRegistries() []*Registry {
 	return registries
 }
 
+// forget releases the counter values the attached registries remember
+// for the reporters in dropped which are not contained in kept.
+func (r *Reporting) forget(dropped, kept []Reporter) {
+	for _, reporter := range dropped {
+		if !reflect.ValueOf(reporter).Comparable() || containsReporter(kept, reporter) {
+			continue
+		}
+		for _, registry := range r.allRegistries() {
+			registry.Forget(reporter)
+		}
+	}
+}
+
+func containsReporter(reporters []Reporter, reporter Reporter) bool {
+	for _, rep := range reporters {
+		if reflect.ValueOf(rep).Comparable() && rep == reporter {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Reporting) checkRunning() {
 	if r.settingsChan == nil {
 		panic("reporting was stopped")
 	}
 }
 
-func (r *Reporting) run(settings *reportingSettings) {
+func (r *Reporting) run(settingsChan <-chan *reportingSettings, settings *reportingSettings) {
 	defer r.wg.Done()
 
 	ticker := time.NewTicker(settings.interval)
@@ -115,13 +141,15 @@ func (r *Reporting) run(settings *reportingSettings) {
 
 	for {
 		select {
-		case s, ok := <-r.settingsChan:
+		case s, ok := <-settingsChan:
 			if !ok {
+				r.forget(settings.reporters, nil)
 				return
 			}
 			// restart the ticker
 			ticker.Stop()
 			ticker = time.NewTicker(s.interval)
+			r.forget(settings.reporters, s.reporters)
 			settings = s
 
 		case <-ticker.C:
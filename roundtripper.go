@@ -0,0 +1,219 @@
+package quant
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Error kinds used in the error counter names of InstrumentRoundTripper.
+const (
+	ErrorKindDNS     = "dns"
+	ErrorKindConnect = "connect"
+	ErrorKindTLS     = "tls"
+	ErrorKindTimeout = "timeout"
+	ErrorKindOther   = "other"
+)
+
+// InstrumentRoundTripper wraps the given round tripper to record the
+// metrics of outbound requests into the registry. If base is nil,
+// http.DefaultTransport is used. All metrics are created on demand per
+// host of the request URL and named as follows:
+//
+//	<prefix>.<host>.latency           timer for the whole round trip
+//	<prefix>.<host>.status.<class>    counter per status class (e.g. 2xx)
+//	<prefix>.<host>.errors.<kind>     counter per error kind (see ErrorKindDNS etc.)
+//	<prefix>.<host>.dns               timer for the DNS lookup
+//	<prefix>.<host>.connect           timer for establishing the connection
+//	<prefix>.<host>.tls               timer for the TLS handshake
+//	<prefix>.<host>.ttfb              timer until the first response byte
+//
+// The phase timers are only updated if the respective phase took place,
+// e.g. reused connections do not record DNS and connect timings. If a
+// name already belongs to a metric of another type, the respective
+// measurement is dropped.
+func InstrumentRoundTripper(registry *Registry, prefix string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &roundTripper{
+		registry: registry,
+		prefix:   prefix,
+		base:     base,
+	}
+}
+
+type roundTripper struct {
+	registry *Registry
+	prefix   string
+	base     http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	prefix := rt.prefix + "." + req.URL.Host + "."
+	trace := &requestTrace{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	resp, err := rt.base.RoundTrip(req)
+	rt.updateTimer(prefix+"latency", time.Since(trace.start))
+
+	phases := trace.phases()
+	for _, p := range phases {
+		if p.d >= 0 {
+			rt.updateTimer(prefix+p.name, p.d)
+		}
+	}
+
+	if err != nil {
+		rt.incrementCounter(prefix + "errors." + trace.errorKind(err))
+		return nil, err
+	}
+	rt.incrementCounter(prefix + "status." + statusClass(resp.StatusCode))
+	return resp, nil
+}
+
+// updateTimer records the duration with the given timer. If the name
+// belongs to another metric type, the duration is dropped.
+func (rt *roundTripper) updateTimer(name string, d time.Duration) {
+	if timer := rt.registry.timerOrNewIfFree(name, Milliseconds); timer != nil {
+		timer.Update(d)
+	}
+}
+
+// incrementCounter increments the given counter. If the name belongs to
+// another metric type, the increment is dropped.
+func (rt *roundTripper) incrementCounter(name string) {
+	if counter := rt.registry.counterOrNewIfFree(name); counter != nil {
+		counter.Increment()
+	}
+}
+
+// requestTrace collects the phase timings of a single request. The
+// hooks of a client trace might be called concurrently (e.g. when
+// dialing several addresses), so the fields are protected by a mutex.
+type requestTrace struct {
+	start time.Time
+
+	mtx         sync.Mutex
+	dnsStart    time.Time
+	dns         time.Duration
+	dnsErr      error
+	dnsDone     bool
+	connStart   time.Time
+	connect     time.Duration
+	connectErr  error
+	connectDone bool
+	tlsStart    time.Time
+	tls         time.Duration
+	tlsErr      error
+	tlsDone     bool
+	ttfb        time.Duration
+	ttfbDone    bool
+}
+
+type tracePhase struct {
+	name string
+	d    time.Duration
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mtx.Lock()
+			t.dnsStart = time.Now()
+			t.mtx.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mtx.Lock()
+			t.dns, t.dnsErr = time.Since(t.dnsStart), info.Err
+			t.dnsDone = true
+			t.mtx.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			t.mtx.Lock()
+			if t.connStart.IsZero() {
+				t.connStart = time.Now()
+			}
+			t.mtx.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mtx.Lock()
+			// the first successful connection wins
+			if !t.connectDone || t.connectErr != nil {
+				t.connect, t.connectErr = time.Since(t.connStart), err
+				t.connectDone = true
+			}
+			t.mtx.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mtx.Lock()
+			t.tlsStart = time.Now()
+			t.mtx.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mtx.Lock()
+			t.tls, t.tlsErr = time.Since(t.tlsStart), err
+			t.tlsDone = true
+			t.mtx.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mtx.Lock()
+			t.ttfb = time.Since(t.start)
+			t.ttfbDone = true
+			t.mtx.Unlock()
+		},
+	}
+}
+
+// phases returns the timings of all phases. Phases which did not
+// complete successfully have a negative duration.
+func (t *requestTrace) phases() []tracePhase {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	phase := func(name string, d time.Duration, done bool, err error) tracePhase {
+		if !done || err != nil {
+			d = -1
+		}
+		return tracePhase{name, d}
+	}
+	return []tracePhase{
+		phase("dns", t.dns, t.dnsDone, t.dnsErr),
+		phase("connect", t.connect, t.connectDone, t.connectErr),
+		phase("tls", t.tls, t.tlsDone, t.tlsErr),
+		phase("ttfb", t.ttfb, t.ttfbDone, nil),
+	}
+}
+
+// errorKind classifies the error of a round trip. The traced phase
+// errors take precedence over the inspection of the error itself.
+func (t *requestTrace) errorKind(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorKindTimeout
+	}
+
+	t.mtx.Lock()
+	dnsErr, connectErr, tlsErr := t.dnsErr, t.connectErr, t.tlsErr
+	t.mtx.Unlock()
+
+	var dnsError *net.DNSError
+	var opError *net.OpError
+	var tlsError *tls.CertificateVerificationError
+	var recordError tls.RecordHeaderError
+	switch {
+	case dnsErr != nil || errors.As(err, &dnsError):
+		return ErrorKindDNS
+	case tlsErr != nil || errors.As(err, &tlsError) || errors.As(err, &recordError):
+		return ErrorKindTLS
+	case connectErr != nil || (errors.As(err, &opError) && opError.Op == "dial"):
+		return ErrorKindConnect
+	default:
+		return ErrorKindOther
+	}
+}
@@ -0,0 +1,136 @@
+package quant
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	reg := NewRegistry("reg")
+	client := &http.Client{Transport: InstrumentRoundTripper(reg, "client", nil)}
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	u, _ := url.Parse(srv.URL)
+	prefix := "client." + u.Host + "."
+	if c := reg.Counter(prefix + "status.2xx"); c == nil || c.Value() != 2 {
+		t.Error("wrong number of successful requests")
+	}
+	if c := reg.Counter(prefix + "status.4xx"); c == nil || c.Value() != 1 {
+		t.Error("wrong number of failed requests")
+	}
+	if tm := reg.Timer(prefix + "latency"); tm == nil || tm.snapshot().Count() != 3 {
+		t.Error("wrong number of latency measurements")
+	}
+	if tm := reg.Timer(prefix + "connect"); tm == nil || tm.snapshot().Count() != 1 {
+		t.Error("wrong number of connect measurements (connection should be reused)")
+	}
+	if tm := reg.Timer(prefix + "ttfb"); tm == nil || tm.snapshot().Count() != 3 {
+		t.Error("wrong number of ttfb measurements")
+	}
+}
+
+func TestInstrumentRoundTripperNameCollision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	prefix := "client." + u.Host + "."
+	reg := NewRegistry("reg")
+	reg.NewCounter(prefix + "latency")
+	reg.NewTimer(prefix+"status.2xx", Milliseconds)
+
+	client := &http.Client{Transport: InstrumentRoundTripper(reg, "client", nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if c := reg.Counter(prefix + "latency"); c == nil || c.Value() != 0 {
+		t.Error("latency recorded into a counter")
+	}
+	if tm := reg.Timer(prefix + "ttfb"); tm == nil || tm.snapshot().Count() != 1 {
+		t.Error("wrong number of ttfb measurements")
+	}
+}
+
+func TestInstrumentRoundTripperErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind string
+	}{
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ErrorKindDNS},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorKindConnect},
+		{context.DeadlineExceeded, ErrorKindTimeout},
+		{errors.New("boom"), ErrorKindOther},
+	}
+
+	for _, test := range tests {
+		reg := NewRegistry("reg")
+		base := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return nil, test.err
+		})
+		rt := InstrumentRoundTripper(reg, "client", base)
+
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		if _, err := rt.RoundTrip(req); err != test.err {
+			t.Errorf("wrong error: %v (%v expected)", err, test.err)
+		}
+		if c := reg.Counter("client.example.com.errors." + test.kind); c == nil || c.Value() != 1 {
+			t.Errorf("no %s error counted for %v", test.kind, test.err)
+		}
+	}
+}
+
+func TestInstrumentRoundTripperConnectError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	reg := NewRegistry("reg")
+	client := &http.Client{
+		Transport: InstrumentRoundTripper(reg, "client", nil),
+		Timeout:   5 * time.Second,
+	}
+	if _, err := client.Get("http://" + addr); err == nil {
+		t.Fatal("expected connection error")
+	}
+	if c := reg.Counter("client." + addr + ".errors.connect"); c == nil || c.Value() != 1 {
+		t.Error("no connect error counted")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
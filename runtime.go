@@ -0,0 +1,134 @@
+package quant
+
+import (
+	"math"
+	"runtime/metrics"
+)
+
+// Names of the gauges registered by RegisterRuntimeMetrics.
+const (
+	RuntimeGoroutines   = "go.goroutines"
+	RuntimeHeapAlloc    = "go.heap.alloc"
+	RuntimeHeapInuse    = "go.heap.inuse"
+	RuntimeHeapObjects  = "go.heap.objects"
+	RuntimeGCCount      = "go.gc.count"
+	RuntimeGCPauseP50   = "go.gc.pause.p50"
+	RuntimeGCPauseP90   = "go.gc.pause.p90"
+	RuntimeGCPauseP99   = "go.gc.pause.p99"
+	RuntimeGCPauseMax   = "go.gc.pause.max"
+	RuntimeCgoCalls     = "go.cgo.calls"
+	runtimeHeapUnused   = "go.heap.unused"
+	runtimeGCPauseTotal = "go.gc.pause"
+)
+
+// runtimeSamples maps the gauge names to the names of the runtime
+// metrics they are read from. If several runtime metrics are listed,
+// the first one supported by the runtime is used.
+var runtimeSamples = []struct {
+	gauge   string
+	samples []string
+}{
+	{RuntimeGoroutines, []string{"/sched/goroutines:goroutines"}},
+	{RuntimeHeapAlloc, []string{"/memory/classes/heap/objects:bytes"}},
+	{runtimeHeapUnused, []string{"/memory/classes/heap/unused:bytes"}},
+	{RuntimeHeapObjects, []string{"/gc/heap/objects:objects"}},
+	{RuntimeGCCount, []string{"/gc/cycles/total:gc-cycles"}},
+	{runtimeGCPauseTotal, []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"}},
+	{RuntimeCgoCalls, []string{"/cgo/go-to-c-calls:calls"}},
+}
+
+// RegisterRuntimeMetrics registers a set of gauges for the statistics
+// of the Go runtime: the number of goroutines, the heap usage, the
+// number of completed GC cycles, the percentiles of the GC pauses and
+// the number of cgo calls. All values are sampled by a single call to
+// runtime/metrics per report. The GC pause percentiles cover all pauses
+// since the program start.
+// If one of the gauge names already exists this function will panic.
+func RegisterRuntimeMetrics(registry *Registry) {
+	supported := make(map[string]struct{})
+	for _, desc := range metrics.All() {
+		supported[desc.Name] = struct{}{}
+	}
+
+	var samples []metrics.Sample
+	gauges := make(map[string]int) // gauge name => sample index
+	for _, s := range runtimeSamples {
+		for _, name := range s.samples {
+			if _, ok := supported[name]; ok {
+				gauges[s.gauge] = len(samples)
+				samples = append(samples, metrics.Sample{Name: name})
+				break
+			}
+		}
+	}
+
+	reader := func() map[string]float64 {
+		metrics.Read(samples)
+
+		values := make(map[string]float64, len(gauges)+4)
+		for gauge, idx := range gauges {
+			value := samples[idx].Value
+			switch value.Kind() {
+			case metrics.KindUint64:
+				values[gauge] = float64(value.Uint64())
+			case metrics.KindFloat64:
+				values[gauge] = value.Float64()
+			case metrics.KindFloat64Histogram:
+				h := value.Float64Histogram()
+				values[RuntimeGCPauseP50] = histogramQuantile(h, 0.5)
+				values[RuntimeGCPauseP90] = histogramQuantile(h, 0.9)
+				values[RuntimeGCPauseP99] = histogramQuantile(h, 0.99)
+				values[RuntimeGCPauseMax] = histogramQuantile(h, 1)
+			}
+		}
+		if unused, ok := values[runtimeHeapUnused]; ok {
+			values[RuntimeHeapInuse] = values[RuntimeHeapAlloc] + unused
+			delete(values, runtimeHeapUnused)
+		}
+		return values
+	}
+
+	registry.NewGaugeSetWithUnits(reader, map[string]string{
+		RuntimeGoroutines:  "",
+		RuntimeHeapAlloc:   "B",
+		RuntimeHeapInuse:   "B",
+		RuntimeHeapObjects: "",
+		RuntimeGCCount:     "",
+		RuntimeGCPauseP50:  "s",
+		RuntimeGCPauseP90:  "s",
+		RuntimeGCPauseP99:  "s",
+		RuntimeGCPauseMax:  "s",
+		RuntimeCgoCalls:    "",
+	})
+}
+
+// histogramQuantile returns an estimation of the q-quantile of the
+// given runtime histogram. The result is the upper boundary of the
+// bucket containing the quantile, or its lower boundary if the bucket
+// is unbounded. For empty histograms zero will be returned.
+func histogramQuantile(h *metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cum uint64
+	for i, c := range h.Counts {
+		cum += c
+		if cum >= rank {
+			if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+			return h.Buckets[i]
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
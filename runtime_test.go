@@ -0,0 +1,55 @@
+package quant
+
+import (
+	"math"
+	"runtime/metrics"
+	"testing"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	reg := NewRegistry("reg")
+	RegisterRuntimeMetrics(reg)
+
+	values := make(map[string]float64)
+	reg.Report(&testReporter{
+		reportGauges: func(registryName string, gauges []*GaugeSnapshot) error {
+			for _, g := range gauges {
+				values[g.Name()] = g.Value()
+			}
+			return nil
+		},
+	})
+
+	if len(values) != 10 {
+		t.Errorf("wrong number of runtime gauges: %d (10 expected)", len(values))
+	}
+	if values[RuntimeGoroutines] < 1 {
+		t.Errorf("wrong number of goroutines: %f (at least 1 expected)", values[RuntimeGoroutines])
+	}
+	if values[RuntimeHeapAlloc] <= 0 || values[RuntimeHeapInuse] < values[RuntimeHeapAlloc] {
+		t.Errorf("wrong heap usage: alloc=%f, inuse=%f", values[RuntimeHeapAlloc], values[RuntimeHeapInuse])
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 2, 1},
+		Buckets: []float64{0, 1, 2, math.Inf(1)},
+	}
+
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0, 1},
+		{0.25, 1},
+		{0.5, 2},
+		{0.75, 2},
+		{1, 2},
+	}
+	for _, test := range tests {
+		if v := histogramQuantile(h, test.q); v != test.expected {
+			t.Errorf("wrong %f-quantile: %f (%f expected)", test.q, v, test.expected)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package quant
+
+import (
+	"math"
+)
+
+// ddMaxBins is the maximum number of bins per store of a DDSketch. If a
+// store exceeds this limit, its lowest bins are collapsed, so that only
+// the quantiles of the smallest values lose their accuracy guarantee.
+const ddMaxBins = 2048
+
+// ddSketch is a quantile sketch with a relative accuracy guarantee
+// (DDSketch, Masson et al., 2019). Positive values are counted in
+// logarithmically sized bins, where the bin with index i covers the
+// range (gamma^(i-1), gamma^i]. Every value of a bin is estimated by
+// a value whose relative error is at most alpha. Negative values are
+// counted in a separate store by their absolute values. Two sketches
+// with the same relative accuracy merge without any loss of accuracy.
+type ddSketch struct {
+	alpha    float64
+	gamma    float64
+	logGamma float64
+	zero     uint64
+	pos      ddStore
+	neg      ddStore
+}
+
+func newDDSketch(alpha float64) *ddSketch {
+	gamma := (1 + alpha) / (1 - alpha)
+	return &ddSketch{
+		alpha:    alpha,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+	}
+}
+
+func (s *ddSketch) clone() *ddSketch {
+	c := *s
+	c.pos.bins = append([]uint64(nil), s.pos.bins...)
+	c.neg.bins = append([]uint64(nil), s.neg.bins...)
+	return &c
+}
+
+func (s *ddSketch) count() uint64 {
+	return s.zero + s.pos.count() + s.neg.count()
+}
+
+func (s *ddSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+func (s *ddSketch) value(idx int) float64 {
+	return 2 * math.Exp(float64(idx)*s.logGamma) / (s.gamma + 1)
+}
+
+// add adds n occurrences of v to the sketch. Values which cannot be
+// indexed (NaN, infinity) are ignored.
+func (s *ddSketch) add(v float64, n uint64) {
+	switch {
+	case math.IsNaN(v) || math.IsInf(v, 0):
+	case v > 0:
+		s.pos.add(s.index(v), n)
+	case v < 0:
+		s.neg.add(s.index(-v), n)
+	default:
+		s.zero += n
+	}
+}
+
+// each calls fn for each non-empty bin with the estimated value of the
+// bin.
+func (s *ddSketch) each(fn func(v float64, n uint64)) {
+	for i := len(s.neg.bins) - 1; i >= 0; i-- {
+		if n := s.neg.bins[i]; n != 0 {
+			fn(-s.value(s.neg.offset+i), n)
+		}
+	}
+	if s.zero != 0 {
+		fn(0, s.zero)
+	}
+	for i, n := range s.pos.bins {
+		if n != 0 {
+			fn(s.value(s.pos.offset+i), n)
+		}
+	}
+}
+
+// merge adds all values of other to the sketch. If both sketches have
+// a different relative accuracy, the values of other are re-indexed,
+// which adds the error of both sketches.
+func (s *ddSketch) merge(other *ddSketch) {
+	if s.alpha == other.alpha {
+		s.zero += other.zero
+		for i, n := range other.pos.bins {
+			s.pos.add(other.pos.offset+i, n)
+		}
+		for i, n := range other.neg.bins {
+			s.neg.add(other.neg.offset+i, n)
+		}
+		return
+	}
+
+	other.each(s.add)
+}
+
+// scaled returns a sketch whose values are multiplied by the given
+// positive factor.
+func (s *ddSketch) scaled(factor float64) *ddSketch {
+	res := newDDSketch(s.alpha)
+	s.each(func(v float64, n uint64) {
+		res.add(v*factor, n)
+	})
+	return res
+}
+
+// quantile returns the estimated q-quantile (0 <= q <= 1), which is the
+// value with the rank q*(count-1) in the sorted list of all values.
+func (s *ddSketch) quantile(q float64) float64 {
+	n := s.count()
+	if n == 0 {
+		return math.NaN()
+	}
+
+	rank := q * float64(n-1)
+	var cum float64
+	for i := len(s.neg.bins) - 1; i >= 0; i-- {
+		if cum += float64(s.neg.bins[i]); cum > rank {
+			return -s.value(s.neg.offset + i)
+		}
+	}
+	if cum += float64(s.zero); cum > rank {
+		return 0
+	}
+	for i, c := range s.pos.bins {
+		if cum += float64(c); cum > rank {
+			return s.value(s.pos.offset + i)
+		}
+	}
+	return s.value(s.pos.offset + len(s.pos.bins) - 1)
+}
+
+// valid reports whether the sketch is consistent with the given number
+// of values, e.g. after decoding it from untrusted data. All bins must
+// be within the range of indexable values and the sketch must not count
+// more values than given. It may count less, since values which cannot
+// be indexed (NaN, infinity) are ignored.
+func (s *ddSketch) valid(count uint64) bool {
+	minIdx, maxIdx := s.index(math.SmallestNonzeroFloat64), s.index(math.MaxFloat64)
+	total := s.zero
+	for _, store := range []*ddStore{&s.pos, &s.neg} {
+		if len(store.bins) > ddMaxBins {
+			return false
+		}
+		if len(store.bins) != 0 && (store.offset < minIdx || store.offset > maxIdx-len(store.bins)+1) {
+			return false
+		}
+		for _, n := range store.bins {
+			if total+n < total {
+				return false // overflow
+			}
+			total += n
+		}
+	}
+	return total <= count
+}
+
+// ddStore is a dense store of bin counts. The first bin has the index
+// offset.
+type ddStore struct {
+	offset int
+	bins   []uint64
+}
+
+func (s *ddStore) count() uint64 {
+	var n uint64
+	for _, c := range s.bins {
+		n += c
+	}
+	return n
+}
+
+func (s *ddStore) add(idx int, n uint64) {
+	if len(s.bins) == 0 {
+		s.offset = idx
+		s.bins = append(s.bins, n)
+		return
+	}
+
+	switch high := s.offset + len(s.bins) - 1; {
+	case idx < s.offset:
+		// collapse values below the lowest possible bin into it
+		if low := high - ddMaxBins + 1; idx < low {
+			idx = low
+		}
+		if idx < s.offset {
+			s.bins = append(make([]uint64, s.offset-idx, s.offset-idx+len(s.bins)), s.bins...)
+			s.offset = idx
+		}
+	case idx > high:
+		// collapse the lowest bins before growing, so the store never
+		// exceeds the maximum number of bins
+		if low := idx - ddMaxBins + 1; low > s.offset {
+			if k := low - s.offset; k < len(s.bins) {
+				for _, c := range s.bins[:k] {
+					s.bins[k] += c
+				}
+				s.bins = s.bins[k:]
+			} else {
+				s.bins = []uint64{s.count()}
+			}
+			s.offset = low
+			high = s.offset + len(s.bins) - 1
+		}
+		s.bins = append(s.bins, make([]uint64, idx-high)...)
+	}
+	s.bins[idx-s.offset] += n
+}
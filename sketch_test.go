@@ -0,0 +1,174 @@
+package quant
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDDSketchAccuracy(t *testing.T) {
+	const alpha = 0.01
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = math.Exp(rng.NormFloat64() * 3)
+		if i%10 == 0 {
+			values[i] = -values[i]
+		}
+	}
+
+	sketch := newDDSketch(alpha)
+	for _, v := range values {
+		sketch.add(v, 1)
+	}
+	sort.Float64s(values)
+
+	for _, q := range []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		expected := values[int(q*float64(len(values)-1))]
+		if res := sketch.quantile(q); math.Abs(res-expected) > alpha*math.Abs(expected) {
+			t.Errorf("wrong %v-quantile: %v (%v expected)", q, res, expected)
+		}
+	}
+}
+
+func TestDDSketchMerge(t *testing.T) {
+	whole, s1, s2 := newDDSketch(0.02), newDDSketch(0.02), newDDSketch(0.02)
+	for i := 1; i <= 1000; i++ {
+		v := float64(i * i)
+		whole.add(v, 1)
+		if i%3 == 0 {
+			s1.add(v, 1)
+		} else {
+			s2.add(v, 1)
+		}
+	}
+
+	s1.merge(s2)
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 1} {
+		if res, expected := s1.quantile(q), whole.quantile(q); res != expected {
+			t.Errorf("wrong %v-quantile: %v (%v expected)", q, res, expected)
+		}
+	}
+}
+
+func TestDDStoreCollapse(t *testing.T) {
+	var s ddStore
+	s.add(0, 1)
+	s.add(ddMaxBins+9, 1)
+	if len(s.bins) != ddMaxBins || s.offset != 10 || s.bins[0] != 1 {
+		t.Errorf("wrong store after growing: len=%d, offset=%d", len(s.bins), s.offset)
+	}
+	s.add(-5, 2)
+	if len(s.bins) != ddMaxBins || s.offset != 10 || s.bins[0] != 3 {
+		t.Errorf("wrong store after adding a low index: len=%d, offset=%d", len(s.bins), s.offset)
+	}
+	if s.count() != 4 {
+		t.Errorf("wrong count: %d (4 expected)", s.count())
+	}
+}
+
+func TestDDStoreCollapseFarIndex(t *testing.T) {
+	var s ddStore
+	s.add(0, 1)
+	s.add(1, 2)
+	s.add(math.MaxInt32, 3)
+	if len(s.bins) != ddMaxBins || s.offset != math.MaxInt32-ddMaxBins+1 || s.bins[0] != 3 {
+		t.Errorf("wrong store after growing: len=%d, offset=%d", len(s.bins), s.offset)
+	}
+	if s.count() != 6 {
+		t.Errorf("wrong count: %d (6 expected)", s.count())
+	}
+}
+
+func TestSketchSnapshotInvalidEncoding(t *testing.T) {
+	timer := newSketchTimer("latency", Milliseconds, 0.01)
+	timer.Update(time.Millisecond)
+	snap := timer.snapshot()
+
+	tests := map[string]func(s *ddSketch){
+		"offset too large": func(s *ddSketch) { s.pos.offset = math.MaxInt64 / 2 },
+		"offset too small": func(s *ddSketch) { s.neg = ddStore{math.MinInt64 / 2, []uint64{0}} },
+		"count too large":  func(s *ddSketch) { s.zero = 5 },
+	}
+	for name, corrupt := range tests {
+		invalid := *snap
+		invalid.sketch = snap.sketch.clone()
+		corrupt(invalid.sketch)
+
+		data, _ := invalid.MarshalBinary()
+		var decoded TimerSnapshot
+		if err := decoded.UnmarshalBinary(data); err == nil {
+			t.Errorf("%s: invalid binary sketch accepted", name)
+		}
+		data, _ = json.Marshal(&invalid)
+		if err := json.Unmarshal(data, &decoded); err == nil {
+			t.Errorf("%s: invalid json sketch accepted", name)
+		}
+	}
+}
+
+func TestSketchTimer(t *testing.T) {
+	reg := NewRegistry("reg")
+	timer := reg.NewSketchTimer("latency", Milliseconds, 0.01)
+	for i := 1; i <= 100; i++ {
+		timer.Update(time.Duration(i) * time.Millisecond)
+	}
+
+	var snap *TimerSnapshot
+	reg.Report(&testReporter{
+		reportCounters: func(string, []*CounterSnapshot) error { return nil },
+		reportGauges:   func(string, []*GaugeSnapshot) error { return nil },
+		reportTimers: func(_ string, timers []*TimerSnapshot) error {
+			snap = timers[0]
+			return nil
+		},
+	})
+
+	if snap.RelativeAccuracy() != 0.01 || len(snap.sample) != 0 {
+		t.Errorf("timer does not use a sketch: %v", snap.RelativeAccuracy())
+	}
+	if p90 := snap.Quantile(0.9); math.Abs(p90-90) > 0.9 {
+		t.Errorf("wrong 0.9-quantile: %v (90 expected)", p90)
+	}
+
+	// a uniform sample merged into a sketch snapshot keeps the sketch
+	merged := newTimerSnaphot("latency", "ms")
+	merged.Merge(NewTimerSnapshot("latency", "ms", 1000))
+	merged.Merge(snap)
+	if merged.RelativeAccuracy() != 0.01 || merged.Count() != 101 {
+		t.Errorf("wrong merged snapshot: accuracy=%v, count=%d", merged.RelativeAccuracy(), merged.Count())
+	}
+	if p := merged.Quantile(0.5); math.Abs(p-51) > 0.51 {
+		t.Errorf("wrong 0.5-quantile: %v (51 expected)", p)
+	}
+
+	data, _ := snap.MarshalBinary()
+	var decoded TimerSnapshot
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if decoded.Quantile(0.5) != snap.Quantile(0.5) {
+		t.Errorf("wrong decoded median: %v (%v expected)", decoded.Quantile(0.5), snap.Quantile(0.5))
+	}
+
+	data, _ = json.Marshal(snap)
+	decoded = TimerSnapshot{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if decoded.Quantile(0.5) != snap.Quantile(0.5) {
+		t.Errorf("wrong decoded median: %v (%v expected)", decoded.Quantile(0.5), snap.Quantile(0.5))
+	}
+}
+
+func TestNewSketchTimerInvalidAccuracy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for invalid accuracy")
+		}
+	}()
+	NewRegistry("reg").NewSketchTimer("latency", Milliseconds, 1)
+}
@@ -0,0 +1,174 @@
+package quant
+
+import (
+	"context"
+	"log/slog"
+	"math"
+)
+
+// SlogReporter is a Reporter implementation that writes the metric
+// snapshots as structured log records. By default a record with the
+// message "metric" is written per metric. Each record contains the
+// attributes "registry", "type", "name" and "unit", followed by the
+// typed fields of the snapshot:
+//
+//   - counters: "value", "delta" and "monotonic"
+//   - gauges: "value" or "error" if the gauge could not be read
+//   - timers and histograms: "count", "min", "max", "mean", "stddev"
+//     and one attribute per quantile (e.g. "p99" for the 0.99-quantile).
+//     Timers with an exemplar additionally contain "trace_id".
+//
+// Float attributes with a non-finite value (e.g. a NaN gauge value) are
+// omitted, since they cannot be encoded as JSON numbers.
+//
+// If Grouped is set, a single record is written per registry and metric
+// type instead, with the message "counters", "gauges", "timers" or
+// "histograms" and one attribute group per metric.
+//
+// The zero value writes to the default logger with the level Info. The
+// exported fields configure the reporter and must not be changed once
+// the reporter is in use.
+type SlogReporter struct {
+	// Quantiles contains the quantiles written for timers and histograms.
+	Quantiles []float64
+	// Grouped enables writing one record per registry and metric type.
+	Grouped bool
+
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogReporter creates a new reporter which writes the snapshots to
+// the given logger with the given level. If the logger is nil, the
+// default logger is used (see slog.Default).
+func NewSlogReporter(logger *slog.Logger, level slog.Level) *SlogReporter {
+	return &SlogReporter{
+		Quantiles: DefaultQuantiles,
+		logger:    logger,
+		level:     level,
+	}
+}
+
+// ReportCounters logs the counter snapshots.
+func (r *SlogReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	records := make([][]slog.Attr, 0, len(counters))
+	for _, c := range counters {
+		attrs := []slog.Attr{
+			slog.String("name", c.Name()),
+			slog.String("unit", c.Unit()),
+		}
+		if c.IsFloat() {
+			attrs = appendFloatAttr(attrs, "value", c.FloatValue())
+			attrs = appendFloatAttr(attrs, "delta", c.FloatDelta())
+		} else {
+			attrs = append(attrs, slog.Int64("value", c.Value()), slog.Int64("delta", c.Delta()))
+		}
+		records = append(records, append(attrs, slog.Bool("monotonic", c.Monotonic())))
+	}
+	r.log(registryName, "counter", "counters", records)
+	return nil
+}
+
+// ReportGauges logs the gauge snapshots.
+func (r *SlogReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	records := make([][]slog.Attr, 0, len(gauges))
+	for _, g := range gauges {
+		attrs := []slog.Attr{
+			slog.String("name", g.Name()),
+			slog.String("unit", g.Unit()),
+		}
+		switch {
+		case g.Err() != nil:
+			attrs = append(attrs, slog.String("error", g.Err().Error()))
+		case g.IsInt():
+			attrs = append(attrs, slog.Int64("value", g.IntValue()))
+		default:
+			attrs = appendFloatAttr(attrs, "value", g.Value())
+		}
+		records = append(records, attrs)
+	}
+	r.log(registryName, "gauge", "gauges", records)
+	return nil
+}
+
+// ReportTimers logs the timer snapshots.
+func (r *SlogReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	records := make([][]slog.Attr, 0, len(timers))
+	for _, t := range timers {
+		attrs := r.reservoirAttrs(&t.reservoirSnapshot)
+		if e := t.Exemplar(); e != nil {
+			attrs = append(attrs, slog.String("trace_id", e.TraceID))
+		}
+		records = append(records, attrs)
+	}
+	r.log(registryName, "timer", "timers", records)
+	return nil
+}
+
+// ReportHistograms logs the histogram snapshots.
+func (r *SlogReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	records := make([][]slog.Attr, 0, len(histograms))
+	for _, h := range histograms {
+		records = append(records, r.reservoirAttrs(&h.reservoirSnapshot))
+	}
+	r.log(registryName, "histogram", "histograms", records)
+	return nil
+}
+
+func (r *SlogReporter) reservoirAttrs(s *reservoirSnapshot) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("name", s.Name()),
+		slog.String("unit", s.Unit()),
+		slog.Int("count", s.Count()),
+	}
+	attrs = appendFloatAttr(attrs, "min", s.Minimum())
+	attrs = appendFloatAttr(attrs, "max", s.Maximum())
+	attrs = appendFloatAttr(attrs, "mean", s.Average())
+	attrs = appendFloatAttr(attrs, "stddev", s.StdDeviation())
+	for _, q := range r.Quantiles {
+		attrs = appendFloatAttr(attrs, quantileName(q), s.Quantile(q))
+	}
+	return attrs
+}
+
+// appendFloatAttr appends a float attribute unless the value is NaN or
+// infinite, which slog.JSONHandler cannot encode.
+func appendFloatAttr(attrs []slog.Attr, key string, v float64) []slog.Attr {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return attrs
+	}
+	return append(attrs, slog.Float64(key, v))
+}
+
+// log writes the given records. The first attribute of each record is
+// the metric name, which is used as the group key in grouped mode.
+func (r *SlogReporter) log(registryName, typ, groupMsg string, records [][]slog.Attr) {
+	ctx := context.Background()
+	logger := r.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if len(records) == 0 || !logger.Enabled(ctx, r.level) {
+		return
+	}
+
+	if r.Grouped {
+		attrs := make([]slog.Attr, 0, len(records)+1)
+		attrs = append(attrs, slog.String("registry", registryName))
+		for _, rec := range records {
+			attrs = append(attrs, slog.Attr{
+				Key:   rec[0].Value.String(),
+				Value: slog.GroupValue(rec[1:]...),
+			})
+		}
+		logger.LogAttrs(ctx, r.level, groupMsg, attrs...)
+		return
+	}
+
+	for _, rec := range records {
+		attrs := make([]slog.Attr, 0, len(rec)+2)
+		attrs = append(attrs, slog.String("registry", registryName), slog.String("type", typ))
+		attrs = append(attrs, rec...)
+		logger.LogAttrs(ctx, r.level, "metric", attrs...)
+	}
+}
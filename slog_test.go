@@ -0,0 +1,147 @@
+package quant
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlogReporter(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewMonotonicCounter("requests").Add(3)
+	reg.NewIntGauge("goroutines", func() int64 { return 12 })
+	timer := reg.NewTimer("latency", Milliseconds)
+	timer.Update(time.Millisecond)
+	timer.Start().RecordWithExemplar("abc")
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	r := NewSlogReporter(logger, slog.LevelInfo)
+	r.Quantiles = []float64{0.5}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	records := decodeSlogRecords(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("wrong number of records: %d (3 expected)", len(records))
+	}
+
+	expected := []map[string]any{
+		{"msg": "metric", "registry": "reg", "type": "counter", "name": "requests", "value": 3.0, "delta": 3.0, "monotonic": true},
+		{"msg": "metric", "registry": "reg", "type": "gauge", "name": "goroutines", "value": 12.0},
+		{"msg": "metric", "registry": "reg", "type": "timer", "name": "latency", "unit": "ms", "count": 2.0, "trace_id": "abc"},
+	}
+	for i, rec := range records {
+		for key, value := range expected[i] {
+			if rec[key] != value {
+				t.Errorf("wrong %q of record %d: %v (%v expected)", key, i, rec[key], value)
+			}
+		}
+	}
+	if _, has := records[2]["p50"]; !has {
+		t.Errorf("missing quantile in timer record: %v", records[2])
+	}
+}
+
+func TestSlogReporterGrouped(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("a").Add(1)
+	reg.NewCounter("b").Add(2)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	r := NewSlogReporter(logger, slog.LevelDebug)
+	r.Grouped = true
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output for disabled level: %s", buf.String())
+	}
+
+	r = NewSlogReporter(logger, slog.LevelWarn)
+	r.Grouped = true
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	records := decodeSlogRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("wrong number of records: %d (1 expected)", len(records))
+	}
+	rec := records[0]
+	if rec["msg"] != "counters" || rec["level"] != "WARN" || rec["registry"] != "reg" {
+		t.Errorf("wrong record: %v", rec)
+	}
+	for name, value := range map[string]float64{"a": 1, "b": 2} {
+		group, _ := rec[name].(map[string]any)
+		if group["value"] != value {
+			t.Errorf("wrong value of %q: %v (%v expected)", name, group["value"], value)
+		}
+	}
+}
+
+func TestSlogReporterNonFinite(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewTimer("idle", Milliseconds)
+	reg.NewGauge("nan", func() float64 { return math.NaN() })
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	r := NewSlogReporter(logger, slog.LevelInfo)
+	r.Quantiles = []float64{0.5}
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	records := decodeSlogRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("wrong number of records: %d (2 expected)", len(records))
+	}
+	if _, has := records[0]["value"]; has {
+		t.Errorf("unexpected NaN value in gauge record: %v", records[0])
+	}
+	if records[1]["p50"] != 0.0 {
+		t.Errorf("wrong quantile of idle timer: %v (0 expected)", records[1]["p50"])
+	}
+	if records[1]["count"] != 0.0 {
+		t.Errorf("wrong count of idle timer: %v (0 expected)", records[1]["count"])
+	}
+}
+
+func TestSlogReporterDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	reg := NewRegistry("reg")
+	reg.NewCounter("requests").Add(1)
+	for _, r := range []*SlogReporter{NewSlogReporter(nil, slog.LevelInfo), {Grouped: true}} {
+		if err := reg.Report(r); err != nil {
+			t.Fatalf("unexpected report error: %v", err)
+		}
+	}
+
+	records := decodeSlogRecords(t, &buf)
+	if len(records) != 2 || records[0]["msg"] != "metric" || records[1]["msg"] != "counters" {
+		t.Errorf("wrong records: %v", records)
+	}
+}
+
+func decodeSlogRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
@@ -1,9 +1,16 @@
 package quant
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
 )
 
+// reservoirSize is the maximum number of values a reservoir snapshot
+// keeps to estimate quantiles.
+const reservoirSize = 1028
+
 type snapshot struct {
 	name string
 	unit string
@@ -22,13 +29,32 @@ func (s *snapshot) Unit() string {
 	return s.unit
 }
 
+// reservoirSnapshot keeps the exact statistics of a series of values
+// and a uniform sample of at most reservoirSize values (Vitter's
+// algorithm R) to estimate quantiles. If the snapshot has a sketch or
+// an HDR histogram, the quantiles are estimated by them instead and no
+// sample is kept.
+//
+// The mean and the sum of squared deviations from the mean (m2) are
+// updated with Welford's algorithm and merged with the parallel
+// algorithm of Chan et al., which avoids the catastrophic cancellation
+// of the textbook formula for large, tightly clustered values.
+//
+// An empty snapshot returns zero from all its statistics, including the
+// quantiles, so that reporters do not need to handle NaN values.
 type reservoirSnapshot struct {
 	snapshot
-	count int
-	min   float64
-	max   float64
-	sum   float64
-	sumSq float64
+	count   int
+	min     float64
+	max     float64
+	sum     float64
+	mean    float64
+	m2      float64 // sum of squared deviations from the mean
+	sample  []float64
+	sorted  bool // whether the sample is sorted
+	sketch  *ddSketch
+	hdr     *hdrHistogram
+	buckets *bucketCounts // counts of explicit buckets, if configured
 }
 
 func newReservoirSnaphot(name, unit string) *reservoirSnapshot {
@@ -38,7 +64,8 @@ func newReservoirSnaphot(name, unit string) *reservoirSnapshot {
 		min:      0,
 		max:      0,
 		sum:      0,
-		sumSq:    0,
+		mean:     0,
+		m2:       0,
 	}
 }
 
@@ -59,12 +86,95 @@ func (s *reservoirSnapshot) Maximum() float64 {
 
 // Average returns the mean of all values this snapshot contains.
 func (s *reservoirSnapshot) Average() float64 {
-	return s.sum / float64(s.count)
+	if s.count == 0 {
+		return 0
+	}
+	return s.mean
 }
 
-// Variance returns the variance of all values this snapshot contains.
+// Variance returns the population variance of all values this snapshot
+// contains.
 func (s *reservoirSnapshot) Variance() float64 {
-	return (s.sumSq - s.sum*s.sum/float64(s.count)) / float64(s.count)
+	if s.count == 0 {
+		return 0
+	}
+	return s.m2 / float64(s.count)
+}
+
+// Quantile returns an estimation of the q-quantile (0 <= q <= 1) of all
+// values this snapshot contains. If the metric uses a quantile sketch,
+// the relative error of the estimation is at most RelativeAccuracy.
+// Otherwise the estimation is based on a uniform sample of the values
+// and interpolates linearly between the closest ranks.
+func (s *reservoirSnapshot) Quantile(q float64) float64 {
+	if s.count == 0 || (s.sketch == nil && s.hdr == nil && len(s.sample) == 0) {
+		return 0
+	}
+	switch {
+	case q <= 0:
+		return s.min
+	case q >= 1:
+		return s.max
+	}
+
+	switch {
+	case s.sketch != nil:
+		return math.Min(math.Max(s.sketch.quantile(q), s.min), s.max)
+	case s.hdr != nil:
+		return math.Min(math.Max(s.hdr.quantile(q), s.min), s.max)
+	}
+
+	sorted := s.sample
+	if !s.sorted {
+		sorted = append([]float64(nil), s.sample...)
+		sort.Float64s(sorted)
+	}
+
+	pos := q * float64(len(sorted)-1)
+	idx := int(pos)
+	if idx+1 >= len(sorted) {
+		return sorted[idx]
+	}
+	frac := pos - float64(idx)
+	return sorted[idx] + frac*(sorted[idx+1]-sorted[idx])
+}
+
+// RelativeAccuracy returns the maximum relative error of the quantiles
+// estimated by a quantile sketch. If the quantiles are estimated based
+// on a uniform sample, zero will be returned.
+func (s *reservoirSnapshot) RelativeAccuracy() float64 {
+	if s.sketch == nil {
+		return 0
+	}
+	return s.sketch.alpha
+}
+
+// Buckets returns the buckets of the value distribution sorted by their
+// upper bounds. If the metric has explicit bucket bounds, all buckets
+// are returned, including the empty ones and a last bucket with the
+// upper bound +Inf. If the metric records its values into an HDR
+// histogram, the non-empty buckets are returned. Otherwise nil will be
+// returned.
+func (s *reservoirSnapshot) Buckets() []Bucket {
+	switch {
+	case s.buckets != nil:
+		return s.buckets.buckets()
+	case s.hdr != nil:
+		return s.hdr.buckets()
+	}
+	return nil
+}
+
+// CumulativeBuckets works like Buckets, but the count of each bucket
+// includes the counts of all previous buckets. So each count is the
+// number of values which are less than or equal to the upper bound,
+// like the "le" buckets of Prometheus histograms.
+func (s *reservoirSnapshot) CumulativeBuckets() []Bucket {
+	buckets := s.Buckets()
+	for i := 1; i < len(buckets); i++ {
+		buckets[i].Count += buckets[i-1].Count
+	}
+	return buckets
 }
 
 // StdDeviation returns the standard deviation of all value this snapshot
@@ -88,5 +198,206 @@ func (s *reservoirSnapshot) add(value float64) {
 
 	s.count++
 	s.sum += value
-	s.sumSq += value * value
+	delta := value - s.mean
+	s.mean += delta / float64(s.count)
+	s.m2 += delta * (value - s.mean)
+
+	if s.buckets != nil {
+		s.buckets.add(value, 1)
+	}
+	if s.sketch != nil || s.hdr != nil {
+		s.addWeighted(value, 1)
+	} else if len(s.sample) < reservoirSize {
+		s.sample = append(s.sample, value)
+		s.sorted = false
+	} else if idx := rand.Intn(s.count); idx < reservoirSize {
+		s.sample[idx] = value
+		s.sorted = false
+	}
+}
+
+func (s *reservoirSnapshot) merge(other *reservoirSnapshot) {
+	// bucket counts can only be merged if both snapshots use the same
+	// bounds (see checkMergeBuckets), otherwise they get lost
+	switch {
+	case s.count == 0 && (other.count != 0 || s.buckets == nil):
+		s.buckets = other.buckets.clone()
+	case other.count == 0:
+	case s.buckets.sameBounds(other.buckets):
+		s.buckets.merge(other.buckets)
+	default:
+		s.buckets = nil
+	}
+
+	if other.count == 0 {
+		return
+	}
+	if s.count == 0 {
+		s.min = other.min
+		s.max = other.max
+	} else {
+		if other.min < s.min {
+			s.min = other.min
+		}
+		if other.max > s.max {
+			s.max = other.max
+		}
+	}
+
+	switch {
+	case s.sketch != nil && other.sketch != nil:
+		s.sketch.merge(other.sketch)
+	case s.hdr != nil && other.hdr != nil:
+		s.hdr.merge(other.hdr)
+	case s.sketch != nil || s.hdr != nil:
+		other.eachWeighted(s.addWeighted)
+	case other.sketch != nil || other.hdr != nil:
+		// the merged snapshot keeps the more accurate representation
+		sample, count := s.sample, s.count
+		s.sample = nil
+		if other.sketch != nil {
+			s.sketch = other.sketch.clone()
+		} else {
+			s.hdr = other.hdr.clone()
+		}
+		eachSampleValue(sample, count, s.addWeighted)
+	default:
+		s.sample = mergeSamples(s.sample, s.count, other.sample, other.count)
+		s.sorted = false
+		s.sortSample()
+	}
+	if s.count == 0 {
+		s.mean = other.mean
+		s.m2 = other.m2
+	} else {
+		n1, n2 := float64(s.count), float64(other.count)
+		n := n1 + n2
+		delta := other.mean - s.mean
+		s.mean += delta * (n2 / n)
+		s.m2 += other.m2 + delta*delta*(n1*n2/n)
+	}
+	s.count += other.count
+	s.sum += other.sum
+}
+
+// sortSample sorts the sample in place, so that quantiles can be
+// estimated without sorting a copy of the sample on each call. The
+// order of the values does not matter for the sampling. Since the
+// sample is modified, it must only be called while the snapshot is
+// not shared yet.
+func (s *reservoirSnapshot) sortSample() {
+	if !s.sorted {
+		sort.Float64s(s.sample)
+		s.sorted = true
+	}
+}
+
+// addWeighted adds n occurrences of a value to the sketch or the HDR
+// histogram of the snapshot.
+func (s *reservoirSnapshot) addWeighted(value float64, n uint64) {
+	if s.sketch != nil {
+		s.sketch.add(value, n)
+	} else {
+		s.hdr.add(value, n)
+	}
+}
+
+// eachWeighted calls fn for each value which represents the quantile
+// estimation of the snapshot, together with its number of occurrences.
+func (s *reservoirSnapshot) eachWeighted(fn func(v float64, n uint64)) {
+	switch {
+	case s.sketch != nil:
+		s.sketch.each(fn)
+	case s.hdr != nil:
+		s.hdr.each(fn)
+	default:
+		eachSampleValue(s.sample, s.count, fn)
+	}
+}
+
+// eachSampleValue calls fn for each value of a uniform sample which
+// represents count values. Each value of the sample is weighted equally,
+// so that the total weight equals count.
+func eachSampleValue(sample []float64, count int, fn func(v float64, n uint64)) {
+	if len(sample) == 0 {
+		return
+	}
+	weight, rest := count/len(sample), count%len(sample)
+	for i, v := range sample {
+		n := uint64(weight)
+		if i < rest {
+			n++
+		}
+		fn(v, n)
+	}
+}
+
+// mergeSamples merges two uniform samples which represent n1 and n2
+// values respectively. If both samples fit into the reservoir they are
+// concatenated. Otherwise each value of the result is drawn from one of
+// the samples with a probability proportional to the number of values
+// it represents.
+func mergeSamples(s1 []float64, n1 int, s2 []float64, n2 int) []float64 {
+	if len(s1)+len(s2) <= reservoirSize {
+		return append(append(make([]float64, 0, len(s1)+len(s2)), s1...), s2...)
+	}
+
+	s1 = append([]float64(nil), s1...)
+	s2 = append([]float64(nil), s2...)
+	res := make([]float64, 0, reservoirSize)
+	for len(res) < reservoirSize && (len(s1) != 0 || len(s2) != 0) {
+		src := &s1
+		if len(s1) == 0 || (len(s2) != 0 && rand.Int63n(int64(n1)+int64(n2)) >= int64(n1)) {
+			src = &s2
+		}
+		idx := rand.Intn(len(*src))
+		res = append(res, (*src)[idx])
+		(*src)[idx] = (*src)[len(*src)-1]
+		*src = (*src)[:len(*src)-1]
+	}
+	return res
+}
+
+// scaled returns a copy of the snapshot whose values are multiplied by
+// the given factor and which has the given unit.
+func (s *reservoirSnapshot) scaled(unit string, factor float64) reservoirSnapshot {
+	snap := *s
+	snap.unit = unit
+	snap.min *= factor
+	snap.max *= factor
+	snap.sum *= factor
+	snap.mean *= factor
+	snap.m2 *= factor * factor
+	snap.sample = make([]float64, len(s.sample))
+	for i, v := range s.sample {
+		snap.sample[i] = v * factor
+	}
+	snap.sorted = s.sorted && factor > 0
+	if s.sketch != nil {
+		snap.sketch = s.sketch.scaled(factor)
+	}
+	if s.hdr != nil {
+		snap.hdr = s.hdr.clone()
+		snap.hdr.scale /= factor
+	}
+	if s.buckets != nil {
+		snap.buckets = s.buckets.scaled(factor)
+	}
+	return snap
+}
+
+// checkMergeBuckets returns an error if both snapshots contain values
+// but count them in different buckets, which cannot be merged.
+func checkMergeBuckets(s, other *reservoirSnapshot) error {
+	if s.count == 0 || other.count == 0 || (s.buckets == nil && other.buckets == nil) || s.buckets.sameBounds(other.buckets) {
+		return nil
+	}
+	return fmt.Errorf("cannot merge %s with different bucket bounds", other.name)
+}
+
+func checkMergeUnits(s, other *snapshot) error {
+	if s.unit != other.unit {
+		return fmt.Errorf("cannot merge %s with unit %q into unit %q", other.name, other.unit, s.unit)
+	}
+	return nil
 }
@@ -1,7 +1,12 @@
 package quant
 
 import (
+	"math"
+	"math/big"
+	"math/rand"
+	"sort"
 	"testing"
+	"time"
 )
 
 func TestReservoirSnapshotMinMaxAvg(t *testing.T) {
@@ -52,3 +57,244 @@ func TestReservoirSnapshotVariance(t *testing.T) {
 		t.Errorf("wrong reservoir snapshot variance: %f (%f expected)", s.Variance(), expected)
 	}
 }
+
+func TestReservoirSnapshotEmpty(t *testing.T) {
+	s := newReservoirSnaphot("reservoir", "")
+	s.merge(newReservoirSnaphot("other", ""))
+
+	for name, v := range map[string]float64{
+		"minimum":   s.Minimum(),
+		"maximum":   s.Maximum(),
+		"average":   s.Average(),
+		"variance":  s.Variance(),
+		"deviation": s.StdDeviation(),
+		"quantile":  s.Quantile(0.5),
+	} {
+		if v != 0 {
+			t.Errorf("wrong %s of empty snapshot: %f (0 expected)", name, v)
+		}
+	}
+
+	other := newReservoirSnaphot("other", "")
+	other.add(4)
+	other.add(6)
+	s.merge(other)
+	if s.Average() != 5 || s.Variance() != 1 {
+		t.Errorf("wrong statistics after merging into empty snapshot: avg=%f, var=%f (5, 1 expected)", s.Average(), s.Variance())
+	}
+}
+
+// TestReservoirSnapshotMoments compares the mean and the variance of
+// random series, added directly and merged from random partitions, with
+// a high-precision reference. The series include large, tightly
+// clustered values like nanosecond durations around one second.
+func TestReservoirSnapshotMoments(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		offset := math.Pow(10, float64(rng.Intn(13)))
+		spread := math.Pow(10, float64(rng.Intn(4)))
+		values := make([]float64, 1+rng.Intn(2000))
+		for j := range values {
+			values[j] = offset + spread*rng.NormFloat64()
+		}
+		mean, variance := referenceMoments(values)
+		// the rounding error grows with the number of values and the
+		// condition number, i.e. the ratio of mean and deviation
+		kappa := math.Abs(mean) / math.Sqrt(variance)
+		tolerance := 1e-12 + 4*float64(len(values))*kappa*0x1p-53
+
+		s := newReservoirSnaphot("reservoir", "")
+		parts := []*reservoirSnapshot{newReservoirSnaphot("part", "")}
+		for _, v := range values {
+			s.add(v)
+			if rng.Intn(100) == 0 {
+				parts = append(parts, newReservoirSnaphot("part", ""))
+			}
+			parts[len(parts)-1].add(v)
+		}
+		merged := newReservoirSnaphot("merged", "")
+		for _, p := range rng.Perm(len(parts)) {
+			merged.merge(parts[p])
+		}
+
+		for name, snap := range map[string]*reservoirSnapshot{"added": s, "merged": merged} {
+			if !closeTo(snap.Average(), mean, 1e-12) {
+				t.Errorf("wrong %s average for offset %g and spread %g: %v (%v expected)", name, offset, spread, snap.Average(), mean)
+			}
+			if !closeTo(snap.Variance(), variance, tolerance) {
+				t.Errorf("wrong %s variance for offset %g and spread %g: %v (%v expected)", name, offset, spread, snap.Variance(), variance)
+			}
+		}
+	}
+}
+
+func TestReservoirSnapshotVarianceLargeValues(t *testing.T) {
+	s := newReservoirSnaphot("reservoir", "ns")
+	for i := 0; i < 1000; i++ {
+		s.add(1e9 + float64(i%10))
+	}
+	if v := s.Variance(); !closeTo(v, 8.25, 1e-6) {
+		t.Errorf("wrong variance: %v (8.25 expected)", v)
+	}
+	if d := s.StdDeviation(); math.IsNaN(d) {
+		t.Error("standard deviation is NaN")
+	}
+}
+
+func TestHDRTimerMoments(t *testing.T) {
+	timer := newHDRTimer("latency", Nanoseconds, time.Minute, 3)
+	values := make([]float64, 1000)
+	for i := range values {
+		d := time.Second + time.Duration(i%7)*time.Microsecond
+		values[i] = float64(d)
+		timer.Update(d)
+	}
+	mean, variance := referenceMoments(values)
+
+	snap := timer.snapshot()
+	if !closeTo(snap.Average(), mean, 1e-12) || !closeTo(snap.Variance(), variance, 1e-9) {
+		t.Errorf("wrong statistics: avg=%v, var=%v (%v, %v expected)", snap.Average(), snap.Variance(), mean, variance)
+	}
+}
+
+// referenceMoments computes the mean and the population variance of the
+// values with 512 bits of precision.
+func referenceMoments(values []float64) (float64, float64) {
+	const prec = 512
+	n := new(big.Float).SetPrec(prec).SetInt64(int64(len(values)))
+	sum := new(big.Float).SetPrec(prec)
+	for _, v := range values {
+		sum.Add(sum, big.NewFloat(v))
+	}
+	mean := new(big.Float).SetPrec(prec).Quo(sum, n)
+
+	sq := new(big.Float).SetPrec(prec)
+	for _, v := range values {
+		d := new(big.Float).SetPrec(prec).Sub(big.NewFloat(v), mean)
+		sq.Add(sq, d.Mul(d, d))
+	}
+	variance := sq.Quo(sq, n)
+
+	m, _ := mean.Float64()
+	v, _ := variance.Float64()
+	return m, v
+}
+
+func TestReservoirSnapshotEmptyBackends(t *testing.T) {
+	reg := NewRegistry("reg")
+	timers := []*Timer{
+		reg.NewTimer("sample", Milliseconds),
+		reg.NewSketchTimer("sketch", Milliseconds, 0.01),
+		reg.NewHDRTimer("hdr", Milliseconds, time.Minute, 3),
+		reg.NewBucketedTimer("buckets", Milliseconds, []float64{1}),
+	}
+	for _, timer := range timers {
+		s := timer.snapshot()
+		stats := map[string]float64{
+			"minimum":       s.Minimum(),
+			"maximum":       s.Maximum(),
+			"average":       s.Average(),
+			"variance":      s.Variance(),
+			"std deviation": s.StdDeviation(),
+			"0-quantile":    s.Quantile(0),
+			"0.5-quantile":  s.Quantile(0.5),
+			"1-quantile":    s.Quantile(1),
+		}
+		for name, v := range stats {
+			if v != 0 {
+				t.Errorf("wrong %s of empty %s snapshot: %v (0 expected)", name, s.Name(), v)
+			}
+		}
+	}
+}
+
+func closeTo(v, expected, relErr float64) bool {
+	return math.Abs(v-expected) <= relErr*math.Abs(expected) || v == expected
+}
+
+func TestReservoirSnapshotQuantile(t *testing.T) {
+	s := newReservoirSnaphot("reservoir", "")
+
+	for i := 1; i <= 101; i++ {
+		s.add(float64(i))
+	}
+
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0, 1},
+		{0.5, 51},
+		{0.9, 91},
+		{1, 101},
+	}
+	for _, test := range tests {
+		if v := s.Quantile(test.q); v != test.expected {
+			t.Errorf("wrong %f-quantile: %f (%f expected)", test.q, v, test.expected)
+		}
+	}
+}
+
+func TestReservoirSnapshotSampling(t *testing.T) {
+	s := newReservoirSnaphot("reservoir", "")
+	for i := 0; i < 100*reservoirSize; i++ {
+		s.add(float64(i % 1000))
+	}
+
+	if len(s.sample) != reservoirSize {
+		t.Errorf("wrong sample size: %d (%d expected)", len(s.sample), reservoirSize)
+	}
+	if median := s.Quantile(0.5); median < 400 || median > 600 {
+		t.Errorf("wrong median estimation: %f (about 500 expected)", median)
+	}
+}
+
+func TestReservoirSnapshotSortedSample(t *testing.T) {
+	h := newHistogram("histogram", "")
+	for _, v := range []float64{5, 1, 4, 2, 3} {
+		h.Observe(v)
+	}
+	snap := h.snapshot()
+	if !snap.sorted || !sort.Float64sAreSorted(snap.sample) {
+		t.Fatalf("snapshot sample is not sorted: %v", snap.sample)
+	}
+	if q := snap.Quantile(0.5); q != 3 {
+		t.Errorf("wrong median: %f (3 expected)", q)
+	}
+
+	snap.add(0)
+	if snap.sorted {
+		t.Error("sample is still marked as sorted after adding a value")
+	}
+	if q := snap.Quantile(0.2); q != 1 {
+		t.Errorf("wrong 0.2-quantile after adding a value: %f (1 expected)", q)
+	}
+
+	if converted := snap.scaled("", -1); converted.sorted {
+		t.Error("sample scaled by a negative factor is marked as sorted")
+	}
+}
+
+func TestMergeSamples(t *testing.T) {
+	small := mergeSamples([]float64{1, 2}, 2, []float64{3}, 1)
+	if len(small) != 3 {
+		t.Errorf("wrong size of concatenated samples: %d (3 expected)", len(small))
+	}
+
+	s1, s2 := make([]float64, reservoirSize), make([]float64, reservoirSize)
+	for i := range s2 {
+		s2[i] = 1
+	}
+	merged := mergeSamples(s1, 1000, s2, 3000)
+	if len(merged) != reservoirSize {
+		t.Fatalf("wrong merged sample size: %d (%d expected)", len(merged), reservoirSize)
+	}
+	var ones int
+	for _, v := range merged {
+		ones += int(v)
+	}
+	// the values are drawn proportionally to the represented counts
+	if ratio := float64(ones) / reservoirSize; ratio < 0.65 || ratio > 0.85 {
+		t.Errorf("wrong ratio of the second sample: %f (0.75 expected)", ratio)
+	}
+}
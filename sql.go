@@ -0,0 +1,345 @@
+package quant
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errNamedParameters = errors.New("driver does not support named parameters")
+
+// RegisterDBStats registers gauges and counters for the connection pool
+// statistics of the given database. The statistics are sampled once per
+// report and the metrics are named "db.<name>.<statistic>":
+//
+//	connections.max_open     gauge for the maximum number of open connections
+//	connections.open         gauge for the number of open connections
+//	connections.in_use       gauge for the number of connections in use
+//	connections.idle         gauge for the number of idle connections
+//	wait.count               counter for the number of waits for a connection
+//	wait.duration            counter for the total time waited for a connection (s)
+//	closed.max_idle          counter for the connections closed due to SetMaxIdleConns
+//	closed.max_idle_time     counter for the connections closed due to SetConnMaxIdleTime
+//	closed.max_lifetime      counter for the connections closed due to SetConnMaxLifetime
+//
+// If one of the metric names already exists this function will panic.
+func RegisterDBStats(registry *Registry, name string, db *sql.DB) {
+	prefix := "db." + name + "."
+	maxOpen := registry.NewSettableGauge(prefix + "connections.max_open")
+	open := registry.NewSettableGauge(prefix + "connections.open")
+	inUse := registry.NewSettableGauge(prefix + "connections.in_use")
+	idle := registry.NewSettableGauge(prefix + "connections.idle")
+	waitCount := registry.NewMonotonicCounter(prefix + "wait.count")
+	waitDuration := registry.NewMonotonicFloatCounterWithUnit(prefix+"wait.duration", "s")
+	maxIdleClosed := registry.NewMonotonicCounter(prefix + "closed.max_idle")
+	maxIdleTimeClosed := registry.NewMonotonicCounter(prefix + "closed.max_idle_time")
+	maxLifetimeClosed := registry.NewMonotonicCounter(prefix + "closed.max_lifetime")
+
+	// The statistics contain cumulative values, whereas the counters
+	// are increased by the deltas between two samples.
+	var mtx sync.Mutex
+	var prev sql.DBStats
+	registry.addCollector(func() {
+		stats := db.Stats()
+
+		maxOpen.Set(float64(stats.MaxOpenConnections))
+		open.Set(float64(stats.OpenConnections))
+		inUse.Set(float64(stats.InUse))
+		idle.Set(float64(stats.Idle))
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		addDelta(waitCount, stats.WaitCount, prev.WaitCount)
+		if d := stats.WaitDuration - prev.WaitDuration; d > 0 {
+			waitDuration.Add(d.Seconds())
+		}
+		addDelta(maxIdleClosed, stats.MaxIdleClosed, prev.MaxIdleClosed)
+		addDelta(maxIdleTimeClosed, stats.MaxIdleTimeClosed, prev.MaxIdleTimeClosed)
+		addDelta(maxLifetimeClosed, stats.MaxLifetimeClosed, prev.MaxLifetimeClosed)
+		prev = stats
+	})
+}
+
+func addDelta(c *MonotonicCounter, cur, prev int64) {
+	if cur > prev {
+		c.Add(cur - prev)
+	}
+}
+
+// Operation types used in the timer names of WrapDriver and WrapConnector.
+const (
+	SQLOpQuery    = "query"
+	SQLOpExec     = "exec"
+	SQLOpPrepare  = "prepare"
+	SQLOpBegin    = "begin"
+	SQLOpCommit   = "commit"
+	SQLOpRollback = "rollback"
+)
+
+// WrapDriver wraps a database driver to record the duration of all
+// database operations into the registry. For each operation type (see
+// SQLOpQuery etc.) a timer named "<prefix>.<operation>" is created on
+// demand. If such a name already belongs to a metric of another type,
+// the durations of the respective operation are dropped. The wrapped
+// driver can be registered with sql.Register.
+func WrapDriver(registry *Registry, prefix string, d driver.Driver) driver.Driver {
+	return &sqlDriver{
+		Driver:  d,
+		metrics: &sqlMetrics{registry, prefix},
+	}
+}
+
+// WrapConnector wraps a database connector the same way as WrapDriver
+// wraps a driver. The wrapped connector can be used with sql.OpenDB.
+func WrapConnector(registry *Registry, prefix string, c driver.Connector) driver.Connector {
+	m := &sqlMetrics{registry, prefix}
+	return &sqlConnector{
+		Connector: c,
+		driver:    &sqlDriver{Driver: c.Driver(), metrics: m},
+		metrics:   m,
+	}
+}
+
+type sqlMetrics struct {
+	registry *Registry
+	prefix   string
+}
+
+func (m *sqlMetrics) record(op string, start time.Time) {
+	if timer := m.registry.timerOrNewIfFree(m.prefix+"."+op, Milliseconds); timer != nil {
+		timer.Update(time.Since(start))
+	}
+}
+
+type sqlDriver struct {
+	driver.Driver
+	metrics *sqlMetrics
+}
+
+func (d *sqlDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{conn, d.metrics}, nil
+}
+
+type sqlConnector struct {
+	driver.Connector
+	driver  *sqlDriver
+	metrics *sqlMetrics
+}
+
+func (c *sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{conn, c.metrics}, nil
+}
+
+func (c *sqlConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// sqlConn wraps a driver connection. It implements all optional
+// connection interfaces and returns driver.ErrSkip if the underlying
+// connection does not support them, which makes database/sql fall back
+// to the basic interfaces.
+type sqlConn struct {
+	conn    driver.Conn
+	metrics *sqlMetrics
+}
+
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	defer c.metrics.record(SQLOpPrepare, time.Now())
+	if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStmt{stmt, c.metrics}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	defer c.metrics.record(SQLOpBegin, time.Now())
+	if b, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = beginWithoutOptions(ctx, c.conn, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx, c.metrics}, nil
+}
+
+// beginWithoutOptions starts a transaction on a connection which does
+// not support transaction options. Like database/sql it returns an error
+// for non-default options instead of ignoring them.
+func beginWithoutOptions(ctx context.Context, conn driver.Conn, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return conn.Begin()
+}
+
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.metrics.record(SQLOpQuery, start)
+	}
+	return rows, err
+}
+
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.metrics.record(SQLOpExec, start)
+	}
+	return res, err
+}
+
+func (c *sqlConn) Ping(ctx context.Context) error {
+	if p, ok := c.conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *sqlConn) IsValid() bool {
+	if v, ok := c.conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *sqlConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+type sqlStmt struct {
+	stmt    driver.Stmt
+	metrics *sqlMetrics
+}
+
+func (s *sqlStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *sqlStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer s.metrics.record(SQLOpExec, time.Now())
+	return s.stmt.Exec(args)
+}
+
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer s.metrics.record(SQLOpQuery, time.Now())
+	return s.stmt.Query(args)
+}
+
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	defer s.metrics.record(SQLOpExec, time.Now())
+	return e.ExecContext(ctx, args)
+}
+
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	defer s.metrics.record(SQLOpQuery, time.Now())
+	return q.QueryContext(ctx, args)
+}
+
+func (s *sqlStmt) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+type sqlTx struct {
+	tx      driver.Tx
+	metrics *sqlMetrics
+}
+
+func (t *sqlTx) Commit() error {
+	defer t.metrics.record(SQLOpCommit, time.Now())
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	defer t.metrics.record(SQLOpRollback, time.Now())
+	return t.tx.Rollback()
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errNamedParameters
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
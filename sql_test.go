@@ -0,0 +1,148 @@
+package quant
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+)
+
+func TestDBStats(t *testing.T) {
+	db := sql.OpenDB(WrapConnector(NewRegistry("unused"), "sql", testConnector{}))
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg := NewRegistry("reg")
+	RegisterDBStats(reg, "main", db)
+
+	gauges := make(map[string]float64)
+	reg.Report(&testReporter{
+		reportCounters: func(registryName string, counters []*CounterSnapshot) error {
+			if len(counters) != 5 {
+				t.Errorf("wrong number of counters: %d (5 expected)", len(counters))
+			}
+			return nil
+		},
+		reportGauges: func(registryName string, snaps []*GaugeSnapshot) error {
+			for _, g := range snaps {
+				gauges[g.Name()] = g.Value()
+			}
+			return nil
+		},
+	})
+
+	if gauges["db.main.connections.max_open"] != 3 {
+		t.Errorf("wrong max open connections: %f (3 expected)", gauges["db.main.connections.max_open"])
+	}
+	if gauges["db.main.connections.in_use"] != 1 {
+		t.Errorf("wrong connections in use: %f (1 expected)", gauges["db.main.connections.in_use"])
+	}
+}
+
+func TestWrapConnector(t *testing.T) {
+	reg := NewRegistry("reg")
+	db := sql.OpenDB(WrapConnector(reg, "sql", testConnector{}))
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT"); err != nil {
+		t.Fatalf("unexpected exec error: %v", err)
+	}
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatalf("unexpected query error: %v", err)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("unexpected begin error: %v", err)
+	}
+	tx.Commit()
+
+	for _, op := range []string{SQLOpPrepare, SQLOpExec, SQLOpQuery, SQLOpBegin, SQLOpCommit} {
+		if tm := reg.Timer("sql." + op); tm == nil || tm.snapshot().Count() == 0 {
+			t.Errorf("no timing recorded for %s", op)
+		}
+	}
+	if reg.Timer("sql."+SQLOpRollback) != nil {
+		t.Error("unexpected rollback timer")
+	}
+}
+
+func TestWrapConnectorNameCollision(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("sql." + SQLOpExec)
+	db := sql.OpenDB(WrapConnector(reg, "sql", testConnector{}))
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT"); err != nil {
+		t.Fatalf("unexpected exec error: %v", err)
+	}
+	if reg.Timer("sql."+SQLOpExec) != nil {
+		t.Error("timer created for a name of another metric")
+	}
+	if tm := reg.Timer("sql." + SQLOpPrepare); tm == nil || tm.snapshot().Count() == 0 {
+		t.Error("no timing recorded for prepare")
+	}
+}
+
+func TestWrapConnectorTxOptions(t *testing.T) {
+	reg := NewRegistry("reg")
+	db := sql.OpenDB(WrapConnector(reg, "sql", testConnector{}))
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}); err == nil {
+		t.Error("non-default isolation level is ignored")
+	}
+	if _, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err == nil {
+		t.Error("read-only option is ignored")
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("unexpected begin error: %v", err)
+	}
+	tx.Rollback()
+}
+
+// testConnector provides connections which only implement the basic
+// driver interfaces.
+type testConnector struct{}
+
+func (testConnector) Connect(context.Context) (driver.Conn, error) { return testConn{}, nil }
+func (testConnector) Driver() driver.Driver                        { return testDriver{} }
+
+type testDriver struct{}
+
+func (testDriver) Open(string) (driver.Conn, error) { return testConn{}, nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(string) (driver.Stmt, error) { return testStmt{}, nil }
+func (testConn) Close() error                        { return nil }
+func (testConn) Begin() (driver.Tx, error)           { return testTx{}, nil }
+
+type testStmt struct{}
+
+func (testStmt) Close() error                               { return nil }
+func (testStmt) NumInput() int                              { return -1 }
+func (testStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (testStmt) Query([]driver.Value) (driver.Rows, error)  { return testRows{}, nil }
+
+type testRows struct{}
+
+func (testRows) Columns() []string         { return []string{"a"} }
+func (testRows) Close() error              { return nil }
+func (testRows) Next([]driver.Value) error { return io.EOF }
+
+type testTx struct{}
+
+func (testTx) Commit() error   { return nil }
+func (testTx) Rollback() error { return nil }
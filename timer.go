@@ -39,16 +39,62 @@ func (tu TimeUnit) String() string {
 type Timer struct {
 	metric
 	timeUnit TimeUnit
+	accuracy float64      // relative accuracy of the quantile sketch
+	hdr      *hdrRecorder // lock-free recorder of HDR timers
+	bounds   []float64    // upper bounds of explicit buckets
 	mtx      sync.Mutex
 	snap     *TimerSnapshot
 }
 
 func newTimer(name string, unit TimeUnit) *Timer {
+	return newSketchTimer(name, unit, 0)
+}
+
+// newSketchTimer creates a timer which estimates quantiles with a sketch
+// of the given relative accuracy. If the accuracy is zero, a uniform
+// sample is used instead.
+func newSketchTimer(name string, unit TimeUnit, accuracy float64) *Timer {
+	t := &Timer{
+		metric:   metric{name, unit.String()},
+		timeUnit: unit,
+		accuracy: accuracy,
+	}
+	t.snap = t.newSnapshot()
+	return t
+}
+
+// newHDRTimer creates a timer which records its durations into an HDR
+// histogram with the given highest trackable duration and number of
+// significant digits.
+func newHDRTimer(name string, unit TimeUnit, highest time.Duration, digits int) *Timer {
 	return &Timer{
 		metric:   metric{name, unit.String()},
 		timeUnit: unit,
-		snap:     newTimerSnaphot(name, unit.String()),
+		hdr:      newHDRRecorder(highest, digits),
+	}
+}
+
+// newBucketedTimer creates a timer which additionally counts its
+// durations in buckets with the given upper bounds.
+func newBucketedTimer(name string, unit TimeUnit, bounds []float64) *Timer {
+	t := &Timer{
+		metric:   metric{name, unit.String()},
+		timeUnit: unit,
+		bounds:   bounds,
+	}
+	t.snap = t.newSnapshot()
+	return t
+}
+
+func (t *Timer) newSnapshot() *TimerSnapshot {
+	snap := newTimerSnaphot(t.name, t.unit)
+	if t.accuracy > 0 {
+		snap.sketch = newDDSketch(t.accuracy)
+	}
+	if t.bounds != nil {
+		snap.buckets = newBucketCounts(t.bounds)
 	}
+	return snap
 }
 
 // Start starts the timer and returns a Stopwatch to measure the duration
@@ -57,17 +103,50 @@ func (t *Timer) Start() *Stopwatch {
 	return newStopwatch(t)
 }
 
+// Update adds an already measured duration to the timer.
+func (t *Timer) Update(d time.Duration) {
+	t.record(d)
+}
+
 func (t *Timer) record(d time.Duration) {
+	if t.hdr != nil {
+		t.hdr.record(d, nil)
+		return
+	}
+
 	t.mtx.Lock()
 	t.snap.add(float64(d) / float64(t.timeUnit))
 	t.mtx.Unlock()
 }
 
+func (t *Timer) recordWithExemplar(d time.Duration, traceID string) {
+	value := float64(d) / float64(t.timeUnit)
+	exemplar := &Exemplar{
+		TraceID: traceID,
+		Value:   value,
+		Time:    time.Now(),
+	}
+	if t.hdr != nil {
+		t.hdr.record(d, exemplar)
+		return
+	}
+
+	t.mtx.Lock()
+	t.snap.add(value)
+	t.snap.exemplar = exemplar
+	t.mtx.Unlock()
+}
+
 func (t *Timer) snapshot() *TimerSnapshot {
+	if t.hdr != nil {
+		return t.hdr.snapshot(t.name, t.timeUnit)
+	}
+
 	t.mtx.Lock()
 	snap := t.snap
-	t.snap = newTimerSnaphot(snap.name, snap.unit)
+	t.snap = t.newSnapshot()
 	t.mtx.Unlock()
+	snap.sortSample()
 	return snap
 }
 
@@ -106,10 +185,30 @@ func (sw *Stopwatch) Record() time.Duration {
 	return d
 }
 
+// RecordWithExemplar works like Record, but additionally attaches the
+// given trace ID to the measured duration. The most recent measurement
+// with a trace ID is kept as the exemplar of the timer snapshot, which
+// links the metric to a trace in the tracing system.
+func (sw *Stopwatch) RecordWithExemplar(traceID string) time.Duration {
+	d := sw.Elapsed()
+	sw.timer.recordWithExemplar(d, traceID)
+	return d
+}
+
+// Exemplar represents a single measurement which is linked to a trace.
+type Exemplar struct {
+	TraceID string    // ID of the trace the measurement belongs to
+	Value   float64   // measured value in the unit of the metric
+	Time    time.Time // point in time of the measurement
+}
+
 // TimerSnapshot represents a snapshot of a Timer metric.
 // This snapshot type is used during the reporting process.
+// If the snapshot is empty, all its statistics including the
+// quantiles are zero.
 type TimerSnapshot struct {
 	reservoirSnapshot
+	exemplar *Exemplar
 }
 
 func newTimerSnaphot(name, unit string) *TimerSnapshot {
@@ -117,3 +216,62 @@ func newTimerSnaphot(name, unit string) *TimerSnapshot {
 		reservoirSnapshot: *newReservoirSnaphot(name, unit),
 	}
 }
+
+// NewTimerSnapshot creates a snapshot of a timer which contains the given
+// values. It can be used to pass synthetic snapshots to a reporter.
+func NewTimerSnapshot(name, unit string, values ...float64) *TimerSnapshot {
+	snap := newTimerSnaphot(name, unit)
+	for _, v := range values {
+		snap.add(v)
+	}
+	snap.sortSample()
+	return snap
+}
+
+// Exemplar returns the most recent measurement which was recorded with
+// a trace ID. If no such measurement exists nil will be returned.
+func (s *TimerSnapshot) Exemplar() *Exemplar {
+	return s.exemplar
+}
+
+// Merge adds all measurements of other to the snapshot, e.g. to combine
+// the timers of several processes. Count, sum, minimum and maximum are
+// merged exactly, the quantile estimations are based on a uniform sample
+// of the measurements of both snapshots. The more recent exemplar is
+// kept. An error is returned if both snapshots have different units or
+// if both contain values counted in buckets with different bounds. In
+// this case the snapshot is not changed.
+func (s *TimerSnapshot) Merge(other *TimerSnapshot) error {
+	if err := checkMergeUnits(&s.snapshot, &other.snapshot); err != nil {
+		return err
+	}
+	if err := checkMergeBuckets(&s.reservoirSnapshot, &other.reservoirSnapshot); err != nil {
+		return err
+	}
+
+	s.merge(&other.reservoirSnapshot)
+	if other.exemplar != nil && (s.exemplar == nil || other.exemplar.Time.After(s.exemplar.Time)) {
+		s.exemplar = other.exemplar
+	}
+	return nil
+}
+
+func (s *TimerSnapshot) withName(name string) *TimerSnapshot {
+	snap := *s
+	snap.name = name
+	return &snap
+}
+
+// scaled returns a copy of the snapshot whose values are multiplied by
+// the given factor and which has the given unit.
+func (s *TimerSnapshot) scaled(unit string, factor float64) *TimerSnapshot {
+	snap := &TimerSnapshot{
+		reservoirSnapshot: s.reservoirSnapshot.scaled(unit, factor),
+	}
+	if s.exemplar != nil {
+		exemplar := *s.exemplar
+		exemplar.Value *= factor
+		snap.exemplar = &exemplar
+	}
+	return snap
+}
@@ -23,3 +23,29 @@ func TestStopwatch(t *testing.T) {
 		t.Errorf("wrong time: %s (at least 10ms expected)", d)
 	}
 }
+
+func TestStopwatchExemplar(t *testing.T) {
+	tm := newTimer("my-timer", Milliseconds)
+
+	tm.Start().Record()
+	if ex := tm.snapshot().Exemplar(); ex != nil {
+		t.Errorf("unexpected exemplar: %v", ex)
+	}
+
+	tm.Start().RecordWithExemplar("trace-1")
+	d := tm.Start().RecordWithExemplar("trace-2")
+	tm.Start().Record()
+
+	snap := tm.snapshot()
+	switch ex := snap.Exemplar(); {
+	case ex == nil:
+		t.Error("no exemplar recorded")
+	case ex.TraceID != "trace-2":
+		t.Errorf("wrong exemplar trace id: %s (trace-2 expected)", ex.TraceID)
+	case ex.Value != float64(d)/float64(time.Millisecond):
+		t.Errorf("wrong exemplar value: %f", ex.Value)
+	}
+	if snap.Count() != 3 {
+		t.Errorf("wrong number of measurements: %d (3 expected)", snap.Count())
+	}
+}
@@ -0,0 +1,232 @@
+package quant
+
+import (
+	"strings"
+	"time"
+)
+
+// Dimension represents the physical dimension of a metric unit.
+type Dimension int
+
+// All dimensions a unit can have. Units which are not known to the
+// package have the dimension UnknownDimension.
+const (
+	UnknownDimension Dimension = iota
+	TimeDimension
+	BytesDimension
+	RatioDimension
+	CountDimension
+)
+
+// String returns a string representation of the dimension.
+func (d Dimension) String() string {
+	switch d {
+	case TimeDimension:
+		return "time"
+	case BytesDimension:
+		return "bytes"
+	case RatioDimension:
+		return "ratio"
+	case CountDimension:
+		return "count"
+	default:
+		return "unknown"
+	}
+}
+
+// Unit represents a structured metric unit. The scale is the factor
+// which converts a value of the unit into the base unit of its dimension,
+// which is seconds for time, bytes for bytes and one for ratios and
+// counts. For example, milliseconds have a scale of 0.001.
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Scale     float64
+}
+
+// Units known to the package.
+var (
+	UnitNanoseconds  = Unit{"ns", TimeDimension, 1e-9}
+	UnitMicroseconds = Unit{"µs", TimeDimension, 1e-6}
+	UnitMilliseconds = Unit{"ms", TimeDimension, 1e-3}
+	UnitSeconds      = Unit{"s", TimeDimension, 1}
+	UnitMinutes      = Unit{"min", TimeDimension, 60}
+	UnitHours        = Unit{"h", TimeDimension, 3600}
+
+	UnitBytes     = Unit{"B", BytesDimension, 1}
+	UnitKilobytes = Unit{"KB", BytesDimension, 1e3}
+	UnitMegabytes = Unit{"MB", BytesDimension, 1e6}
+	UnitGigabytes = Unit{"GB", BytesDimension, 1e9}
+	UnitTerabytes = Unit{"TB", BytesDimension, 1e12}
+	UnitKibibytes = Unit{"KiB", BytesDimension, 1 << 10}
+	UnitMebibytes = Unit{"MiB", BytesDimension, 1 << 20}
+	UnitGibibytes = Unit{"GiB", BytesDimension, 1 << 30}
+	UnitTebibytes = Unit{"TiB", BytesDimension, 1 << 40}
+
+	UnitRatio   = Unit{"ratio", RatioDimension, 1}
+	UnitPercent = Unit{"%", RatioDimension, 0.01}
+
+	UnitCount = Unit{"", CountDimension, 1}
+)
+
+var knownUnits = map[string]Unit{
+	"ns":  UnitNanoseconds,
+	"µs":  UnitMicroseconds,
+	"us":  UnitMicroseconds,
+	"ms":  UnitMilliseconds,
+	"s":   UnitSeconds,
+	"min": UnitMinutes,
+	"h":   UnitHours,
+
+	"B":   UnitBytes,
+	"KB":  UnitKilobytes,
+	"MB":  UnitMegabytes,
+	"GB":  UnitGigabytes,
+	"TB":  UnitTerabytes,
+	"KiB": UnitKibibytes,
+	"MiB": UnitMebibytes,
+	"GiB": UnitGibibytes,
+	"TiB": UnitTebibytes,
+
+	"ratio": UnitRatio,
+	"%":     UnitPercent,
+
+	"": UnitCount,
+}
+
+// ParseUnit parses the unit string of a metric. Besides the symbols of
+// the known units, the string representation of custom time units (e.g.
+// "*1m30s") is recognized. Other strings result in a unit with an unknown
+// dimension and a scale of one.
+func ParseUnit(s string) Unit {
+	if u, has := knownUnits[s]; has {
+		return u
+	}
+	if strings.HasPrefix(s, "*") {
+		if d, err := time.ParseDuration(s[1:]); err == nil && d > 0 {
+			return Unit{s, TimeDimension, d.Seconds()}
+		}
+	}
+	return Unit{s, UnknownDimension, 1}
+}
+
+// String returns the symbol of the unit.
+func (u Unit) String() string {
+	return u.Symbol
+}
+
+// Convert converts a value of unit u into a value of the unit to. If both
+// units have different or unknown dimensions, false is returned.
+func (u Unit) Convert(v float64, to Unit) (float64, bool) {
+	if u.Dimension != to.Dimension || u.Dimension == UnknownDimension {
+		return v, false
+	}
+	return v * u.factor(to), true
+}
+
+func (u Unit) factor(to Unit) float64 {
+	if u.Scale == to.Scale {
+		return 1
+	}
+	return u.Scale / to.Scale
+}
+
+// Unit returns the structured unit of the time unit.
+func (tu TimeUnit) Unit() Unit {
+	return ParseUnit(tu.String())
+}
+
+// UnitConverter returns a reporter which converts the values of all
+// metrics with a known dimension into the given target units before
+// passing the snapshots to the inner reporter. If no targets are given,
+// all times are converted into seconds and all sizes into bytes, as the
+// Prometheus conventions require. Metrics whose dimension has no target
+// are passed unchanged. Histograms are passed if the inner reporter
+// implements HistogramReporter.
+//
+// Integer counters and gauges become float values, unless the conversion
+// factor is an integer.
+func UnitConverter(inner Reporter, targets ...Unit) Reporter {
+	if len(targets) == 0 {
+		targets = []Unit{UnitSeconds, UnitBytes}
+	}
+	r := &unitConverter{
+		inner:   inner,
+		targets: make(map[Dimension]Unit, len(targets)),
+	}
+	for _, u := range targets {
+		r.targets[u.Dimension] = u
+	}
+	return r
+}
+
+type unitConverter struct {
+	inner   Reporter
+	targets map[Dimension]Unit
+}
+
+// convert returns the target unit and the conversion factor for the
+// given unit string. If no conversion is necessary, false is returned.
+func (r *unitConverter) convert(unit string) (string, float64, bool) {
+	from := ParseUnit(unit)
+	to, has := r.targets[from.Dimension]
+	if !has || from.Dimension == UnknownDimension || from.Symbol == to.Symbol {
+		return unit, 1, false
+	}
+	return to.Symbol, from.factor(to), true
+}
+
+func (r *unitConverter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	res := make([]*CounterSnapshot, len(counters))
+	for i, c := range counters {
+		res[i] = c
+		if unit, factor, ok := r.convert(c.Unit()); ok {
+			res[i] = c.scaled(unit, factor)
+		}
+	}
+	return r.inner.ReportCounters(registryName, res)
+}
+
+func (r *unitConverter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	res := make([]*GaugeSnapshot, len(gauges))
+	for i, g := range gauges {
+		res[i] = g
+		if unit, factor, ok := r.convert(g.Unit()); ok {
+			res[i] = g.scaled(unit, factor)
+		}
+	}
+	return r.inner.ReportGauges(registryName, res)
+}
+
+func (r *unitConverter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	res := make([]*TimerSnapshot, len(timers))
+	for i, t := range timers {
+		res[i] = t
+		if unit, factor, ok := r.convert(t.Unit()); ok {
+			res[i] = t.scaled(unit, factor)
+		}
+	}
+	return r.inner.ReportTimers(registryName, res)
+}
+
+func (r *unitConverter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	hr, ok := r.inner.(HistogramReporter)
+	if !ok {
+		return nil
+	}
+
+	res := make([]*HistogramSnapshot, len(histograms))
+	for i, h := range histograms {
+		res[i] = h
+		if unit, factor, ok := r.convert(h.Unit()); ok {
+			res[i] = &HistogramSnapshot{reservoirSnapshot: h.reservoirSnapshot.scaled(unit, factor)}
+		}
+	}
+	return hr.ReportHistograms(registryName, res)
+}
+
+// isIntFactor reports whether integer values stay integers when they are
+// multiplied by the given factor.
+func isIntFactor(factor float64) bool {
+	return factor >= 1 && factor == float64(int64(factor))
+}
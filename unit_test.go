@@ -0,0 +1,104 @@
+package quant
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseUnit(t *testing.T) {
+	tests := map[string]Unit{
+		"ms":     UnitMilliseconds,
+		"µs":     UnitMicroseconds,
+		"MB":     UnitMegabytes,
+		"%":      UnitPercent,
+		"":       UnitCount,
+		"*1m30s": {"*1m30s", TimeDimension, 90},
+		"req":    {"req", UnknownDimension, 1},
+	}
+	for s, expected := range tests {
+		if u := ParseUnit(s); u != expected {
+			t.Errorf("wrong unit for %q: %+v (%+v expected)", s, u, expected)
+		}
+	}
+
+	if u := Milliseconds.Unit(); u != UnitMilliseconds {
+		t.Errorf("wrong unit for milliseconds: %+v", u)
+	}
+}
+
+func TestUnitConvert(t *testing.T) {
+	if v, ok := UnitMegabytes.Convert(1.5, UnitBytes); !ok || v != 1.5e6 {
+		t.Errorf("wrong conversion: %v, %v (1500000, true expected)", v, ok)
+	}
+	if v, ok := UnitPercent.Convert(50, UnitRatio); !ok || v != 0.5 {
+		t.Errorf("wrong conversion: %v, %v (0.5, true expected)", v, ok)
+	}
+	if _, ok := UnitSeconds.Convert(1, UnitBytes); ok {
+		t.Error("unexpected conversion between different dimensions")
+	}
+	if _, ok := ParseUnit("req").Convert(1, ParseUnit("req")); ok {
+		t.Error("unexpected conversion of unknown dimension")
+	}
+}
+
+func TestUnitConverter(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounterWithUnit("cpu", "ms").Add(1500)
+	reg.NewCounterWithUnit("transferred", "KiB").Add(2)
+	reg.NewGaugeWithUnit("memory", "MB", func() float64 { return 1.5 })
+	reg.NewGaugeWithUnit("requests", "req", func() float64 { return 3 })
+	timer := reg.NewTimer("latency", Milliseconds)
+	timer.Update(time.Millisecond)
+	timer.Start().RecordWithExemplar("abc")
+	timer.Update(3 * time.Millisecond)
+
+	rec := &recordingReporter{}
+	gauges := make(map[string]*GaugeSnapshot)
+	r := UnitConverter(&testReporter{
+		reportCounters: rec.ReportCounters,
+		reportGauges: func(_ string, snaps []*GaugeSnapshot) error {
+			for _, g := range snaps {
+				gauges[g.Name()] = g
+			}
+			return nil
+		},
+		reportTimers:     rec.ReportTimers,
+		reportHistograms: rec.ReportHistograms,
+	})
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	counters := make(map[string]*CounterSnapshot)
+	for _, c := range rec.counters {
+		counters[c.Name()] = c
+	}
+	if c := counters["cpu"]; c.Unit() != "s" || !c.IsFloat() || c.FloatValue() != 1.5 || c.FloatDelta() != 1.5 {
+		t.Errorf("wrong cpu counter: %s %v %v", c.Unit(), c.IsFloat(), c.FloatValue())
+	}
+	if c := counters["transferred"]; c.Unit() != "B" || c.IsFloat() || c.Value() != 2048 {
+		t.Errorf("wrong transferred counter: %s %v %v", c.Unit(), c.IsFloat(), c.Value())
+	}
+	if g := gauges["memory"]; g.Unit() != "B" || g.Value() != 1.5e6 {
+		t.Errorf("wrong memory gauge: %s %v", g.Unit(), g.Value())
+	}
+	if g := gauges["requests"]; g.Unit() != "req" || g.Value() != 3 {
+		t.Errorf("wrong requests gauge: %s %v", g.Unit(), g.Value())
+	}
+
+	tm := rec.timers[0]
+	switch {
+	case tm.Unit() != "s":
+		t.Errorf("wrong timer unit: %s (s expected)", tm.Unit())
+	case tm.Count() != 3 || tm.Maximum() != 0.003:
+		t.Errorf("wrong timer: count=%d, max=%v (3, 0.003 expected)", tm.Count(), tm.Maximum())
+	case math.Abs(tm.Quantile(1)-0.003) > 1e-12:
+		t.Errorf("wrong timer quantile: %v (0.003 expected)", tm.Quantile(1))
+	case tm.Exemplar() == nil || tm.Exemplar().Value >= 1:
+		t.Errorf("exemplar not scaled: %+v", tm.Exemplar())
+	}
+	if reg.Counter("cpu").Unit() != "ms" {
+		t.Error("unit of the registered counter changed")
+	}
+}
@@ -0,0 +1,272 @@
+package quant
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formatter is an interface that is used by a WriterReporter to format
+// metric snapshots as text.
+type Formatter interface {
+	FormatCounters(w io.Writer, registryName string, counters []*CounterSnapshot) error
+	FormatGauges(w io.Writer, registryName string, gauges []*GaugeSnapshot) error
+	FormatTimers(w io.Writer, registryName string, timers []*TimerSnapshot) error
+	FormatHistograms(w io.Writer, registryName string, histograms []*HistogramSnapshot) error
+}
+
+// WriterReporter is a Reporter implementation that formats the metric
+// snapshots with a Formatter and writes them to an io.Writer. Each group
+// of snapshots is written with a single call to the writer, so that
+// concurrent reports do not interleave.
+type WriterReporter struct {
+	mtx sync.Mutex
+	w   io.Writer
+	f   Formatter
+	buf bytes.Buffer
+}
+
+// NewWriterReporter creates a new reporter which writes the snapshots
+// formatted by f to w.
+func NewWriterReporter(w io.Writer, f Formatter) *WriterReporter {
+	return &WriterReporter{
+		w: w,
+		f: f,
+	}
+}
+
+// ReportCounters writes the counter snapshots.
+func (r *WriterReporter) ReportCounters(registryName string, counters []*CounterSnapshot) error {
+	return r.write(func(w io.Writer) error {
+		return r.f.FormatCounters(w, registryName, counters)
+	})
+}
+
+// ReportGauges writes the gauge snapshots.
+func (r *WriterReporter) ReportGauges(registryName string, gauges []*GaugeSnapshot) error {
+	return r.write(func(w io.Writer) error {
+		return r.f.FormatGauges(w, registryName, gauges)
+	})
+}
+
+// ReportTimers writes the timer snapshots.
+func (r *WriterReporter) ReportTimers(registryName string, timers []*TimerSnapshot) error {
+	return r.write(func(w io.Writer) error {
+		return r.f.FormatTimers(w, registryName, timers)
+	})
+}
+
+// ReportHistograms writes the histogram snapshots.
+func (r *WriterReporter) ReportHistograms(registryName string, histograms []*HistogramSnapshot) error {
+	return r.write(func(w io.Writer) error {
+		return r.f.FormatHistograms(w, registryName, histograms)
+	})
+}
+
+func (r *WriterReporter) write(format func(w io.Writer) error) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.buf.Reset()
+	if err := format(&r.buf); err != nil {
+		return err
+	}
+	_, err := r.w.Write(r.buf.Bytes())
+	return err
+}
+
+// TextFormatter is a Formatter implementation that writes a section per
+// metric type and registry, followed by one line per metric, e.g.
+//
+//	timers of my-registry
+//	  latency: count=3, min=1.2ms, max=4.0ms, avg=2.1ms, dev=1.1
+//
+// The zero value writes all values without decimal places.
+type TextFormatter struct {
+	// Precision is the number of digits after the decimal point. If it
+	// is negative, the smallest number of digits necessary to represent
+	// the value is used.
+	Precision int
+	// Align pads the metric names and fields, so that the lines of a
+	// section form a table.
+	Align bool
+	// HumanUnits scales durations and bytes to a human-friendly unit,
+	// e.g. 1536B is written as 1.5KiB and 1500ms as 1.5s.
+	HumanUnits bool
+	// Timestamp adds the current time to the header of each section.
+	Timestamp bool
+}
+
+// FormatCounters formats the counter snapshots.
+func (f *TextFormatter) FormatCounters(w io.Writer, registryName string, counters []*CounterSnapshot) error {
+	rows := make([][]string, 0, len(counters))
+	for _, c := range counters {
+		value := c.FloatValue()
+		if !c.IsFloat() {
+			value = float64(c.Value())
+		}
+		rows = append(rows, []string{c.Name(), f.value(value, c.Unit(), !c.IsFloat())})
+	}
+	return f.write(w, "counters", registryName, rows)
+}
+
+// FormatGauges formats the gauge snapshots. Gauges which could not be
+// read are written with their error.
+func (f *TextFormatter) FormatGauges(w io.Writer, registryName string, gauges []*GaugeSnapshot) error {
+	rows := make([][]string, 0, len(gauges))
+	for _, g := range gauges {
+		switch {
+		case g.Err() != nil:
+			rows = append(rows, []string{g.Name(), g.Err().Error()})
+		case g.IsInt():
+			rows = append(rows, []string{g.Name(), f.value(float64(g.IntValue()), g.Unit(), true)})
+		default:
+			rows = append(rows, []string{g.Name(), f.value(g.Value(), g.Unit(), false)})
+		}
+	}
+	return f.write(w, "gauges", registryName, rows)
+}
+
+// FormatTimers formats the timer snapshots.
+func (f *TextFormatter) FormatTimers(w io.Writer, registryName string, timers []*TimerSnapshot) error {
+	rows := make([][]string, 0, len(timers))
+	for _, t := range timers {
+		rows = append(rows, f.reservoirRow(&t.reservoirSnapshot))
+	}
+	return f.write(w, "timers", registryName, rows)
+}
+
+// FormatHistograms formats the histogram snapshots.
+func (f *TextFormatter) FormatHistograms(w io.Writer, registryName string, histograms []*HistogramSnapshot) error {
+	rows := make([][]string, 0, len(histograms))
+	for _, h := range histograms {
+		rows = append(rows, f.reservoirRow(&h.reservoirSnapshot))
+	}
+	return f.write(w, "histograms", registryName, rows)
+}
+
+func (f *TextFormatter) reservoirRow(s *reservoirSnapshot) []string {
+	return []string{
+		s.Name(),
+		"count=" + strconv.Itoa(s.Count()),
+		"min=" + f.value(s.Minimum(), s.Unit(), false),
+		"max=" + f.value(s.Maximum(), s.Unit(), false),
+		"avg=" + f.value(s.Average(), s.Unit(), false),
+		"dev=" + f.value(s.StdDeviation(), "", false),
+	}
+}
+
+// write writes the section header and the given rows. The first cell of
+// a row is the metric name, the others are the fields.
+func (f *TextFormatter) write(w io.Writer, kind, registryName string, rows [][]string) error {
+	var widths []int
+	if f.Align {
+		for _, row := range rows {
+			for i, cell := range row {
+				if i == len(widths) {
+					widths = append(widths, 0)
+				}
+				if n := len([]rune(cell)); n > widths[i] {
+					widths[i] = n
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(kind)
+	b.WriteString(" of ")
+	b.WriteString(registryName)
+	if f.Timestamp {
+		b.WriteString(" at ")
+		b.WriteString(time.Now().Format(time.RFC3339))
+	}
+	b.WriteByte('\n')
+	for _, row := range rows {
+		b.WriteString("  ")
+		for i, cell := range row {
+			switch i {
+			case 0:
+				b.WriteString(cell)
+				b.WriteByte(':')
+			case 1:
+				b.WriteByte(' ')
+				b.WriteString(cell)
+			default:
+				b.WriteString(", ")
+				b.WriteString(cell)
+			}
+			if i < len(row)-1 && i < len(widths) {
+				b.WriteString(strings.Repeat(" ", widths[i]-len([]rune(cell))))
+			}
+		}
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// value formats a metric value with its unit. Integer values are written
+// without decimal places unless they are scaled to another unit.
+func (f *TextFormatter) value(v float64, unit string, isInt bool) string {
+	if f.HumanUnits {
+		var scaled bool
+		if v, unit, scaled = humanize(v, unit); scaled {
+			isInt = false
+		}
+	}
+	if isInt {
+		return strconv.FormatInt(int64(v), 10) + unit
+	}
+	return strconv.FormatFloat(v, 'f', f.Precision, 64) + unit
+}
+
+var (
+	durationUnits = []string{"ns", "µs", "ms", "s"}
+	byteUnits     = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+)
+
+// humanize scales a duration or a byte value to the largest unit in which
+// its absolute value is at least one. Values of other units are returned
+// unchanged.
+func humanize(v float64, unit string) (float64, string, bool) {
+	units, factor := durationUnits, 1000.0
+	idx := indexOf(units, unit)
+	if unit == "us" {
+		idx = 1
+	}
+	if idx < 0 {
+		units, factor = byteUnits, 1024.0
+		if idx = indexOf(units, unit); idx < 0 {
+			return v, unit, false
+		}
+	}
+	if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return v, unit, false
+	}
+
+	start := idx
+	for idx > 0 && math.Abs(v) < 1 {
+		v *= factor
+		idx--
+	}
+	for idx < len(units)-1 && math.Abs(v) >= factor {
+		v /= factor
+		idx++
+	}
+	return v, units[idx], idx != start
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,102 @@
+package quant
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterReporter(t *testing.T) {
+	reg := NewRegistry("reg")
+	reg.NewCounter("requests").Add(3)
+	reg.NewGaugeWithUnit("memory", "B", func() float64 { return 1536 })
+	timer := reg.NewTimer("latency", Milliseconds)
+	timer.Update(time.Millisecond)
+	timer.Update(3 * time.Millisecond)
+
+	var buf bytes.Buffer
+	r := NewWriterReporter(&buf, &TextFormatter{Precision: 1})
+	if err := reg.Report(r); err != nil {
+		t.Fatalf("unexpected report error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"counters of reg",
+		"  requests: 3",
+		"gauges of reg",
+		"  memory: 1536.0B",
+		"timers of reg",
+		"  latency: count=2, min=1.0ms, max=3.0ms, avg=2.0ms, dev=1.0",
+		"",
+	}, "\n")
+	if s := buf.String(); s != expected {
+		t.Errorf("wrong output:\n%s\n(expected)\n%s", s, expected)
+	}
+}
+
+func TestTextFormatterAlign(t *testing.T) {
+	f := &TextFormatter{Precision: -1, Align: true, HumanUnits: true}
+	gauges := []*GaugeSnapshot{
+		newGaugeSnapshot("heap", "B", 1536),
+		newIntGaugeSnapshot("goroutines", "", 12),
+		newGaugeSnapshot("broken", "", 0),
+	}
+	gauges[2].err = errors.New("read error")
+
+	var buf bytes.Buffer
+	if err := f.FormatGauges(&buf, "reg", gauges); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"gauges of reg",
+		"  heap:       1.5KiB",
+		"  goroutines: 12",
+		"  broken:     read error",
+		"",
+	}, "\n")
+	if s := buf.String(); s != expected {
+		t.Errorf("wrong output:\n%s\n(expected)\n%s", s, expected)
+	}
+}
+
+func TestTextFormatterTimestamp(t *testing.T) {
+	var buf bytes.Buffer
+	f := &TextFormatter{Timestamp: true}
+	if err := f.FormatCounters(&buf, "reg", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := strings.TrimSpace(buf.String())
+	idx := strings.Index(header, " at ")
+	if idx < 0 {
+		t.Fatalf("missing timestamp: %q", header)
+	}
+	if _, err := time.Parse(time.RFC3339, header[idx+4:]); err != nil {
+		t.Errorf("invalid timestamp: %v", err)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	tests := []struct {
+		value    float64
+		unit     string
+		expected float64
+		expUnit  string
+	}{
+		{1500, "ms", 1.5, "s"},
+		{0.5, "ms", 500, "µs"},
+		{2500, "us", 2.5, "ms"},
+		{3 * 1024 * 1024, "B", 3, "MiB"},
+		{512, "B", 512, "B"},
+		{1500, "req", 1500, "req"},
+	}
+	for _, test := range tests {
+		v, unit, _ := humanize(test.value, test.unit)
+		if v != test.expected || unit != test.expUnit {
+			t.Errorf("wrong result for %v%s: %v%s (%v%s expected)", test.value, test.unit, v, unit, test.expected, test.expUnit)
+		}
+	}
+}